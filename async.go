@@ -0,0 +1,236 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTransactionClosed is returned when adding entities to a closed AsyncTransaction
+var ErrTransactionClosed = errors.New("transaction is closed")
+
+// AsyncOptions configures when an AsyncTransaction sends buffered entities
+type AsyncOptions struct {
+	// MaxEntities triggers a flush once this many entities are buffered; defaults to 100
+	MaxEntities int
+	// FlushInterval triggers a flush of buffered entities after this time; defaults to 1s
+	FlushInterval time.Duration
+	// MaxConcurrency bounds the number of flushes sent in parallel; defaults to 4.
+	// Ordered transactions are always sent one after the other
+	MaxConcurrency int
+	// Ordered sends all flushes as ordered transactions
+	Ordered bool
+}
+
+func (o AsyncOptions) orDefault() AsyncOptions {
+	if o.MaxEntities <= 0 {
+		o.MaxEntities = 100
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second
+	}
+	if o.Ordered {
+		o.MaxConcurrency = 1
+	} else if o.MaxConcurrency <= 0 {
+		o.MaxConcurrency = 4
+	}
+	return o
+}
+
+// AsyncTransaction buffers entities and transacts them in the background once
+// the buffer is full or the flush interval passed. It is safe for concurrent use
+type AsyncTransaction struct {
+	transactor Transactor
+	options    AsyncOptions
+
+	mu      sync.Mutex
+	buffer  []interface{}
+	timer   *time.Timer
+	closed  bool
+	errs    []error
+	pending []chan struct{}
+	sem     chan struct{}
+	// previous is closed once the last dispatched flush finished; ordered
+	// flushes wait for it to keep their sequence
+	previous chan struct{}
+}
+
+// NewAsyncTransaction creates an AsyncTransaction sending entities with transactor
+func NewAsyncTransaction(transactor Transactor, options AsyncOptions) *AsyncTransaction {
+	options = options.orDefault()
+	previous := make(chan struct{})
+	close(previous)
+	return &AsyncTransaction{
+		transactor: transactor,
+		options:    options,
+		buffer:     make([]interface{}, 0),
+		sem:        make(chan struct{}, options.MaxConcurrency),
+		previous:   previous,
+	}
+}
+
+// AddEntities buffers entities to be transacted with the next flush
+func (t *AsyncTransaction) AddEntities(entities ...interface{}) error {
+	added := make([]interface{}, len(entities))
+	for i, e := range entities {
+		added[i] = makeEntity(e)
+	}
+	return t.add(added)
+}
+
+// Retract buffers entities to be retracted with the next flush
+func (t *AsyncTransaction) Retract(entities ...interface{}) error {
+	retracted := make([]interface{}, len(entities))
+	for i, e := range entities {
+		retracted[i] = retractedEntity{entity: makeEntity(e)}
+	}
+	return t.add(retracted)
+}
+
+func (t *AsyncTransaction) add(entities []interface{}) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransactionClosed
+	}
+
+	t.buffer = append(t.buffer, entities...)
+	if len(t.buffer) >= t.options.MaxEntities {
+		t.dispatch()
+	} else if t.timer == nil {
+		var timer *time.Timer
+		timer = time.AfterFunc(t.options.FlushInterval, func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			// a dispatch stopped this timer while the callback was waiting for
+			// the lock; the entities buffered since belong to the next timer
+			if t.timer != timer {
+				return
+			}
+			t.dispatch()
+		})
+		t.timer = timer
+	}
+	return nil
+}
+
+// dispatch sends the buffered entities in the background; t.mu has to be held
+func (t *AsyncTransaction) dispatch() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if len(t.buffer) == 0 {
+		return
+	}
+
+	entities := t.buffer
+	t.buffer = make([]interface{}, 0)
+	previous := t.previous
+	done := make(chan struct{})
+	t.previous = done
+	t.pending = append(t.pending, done)
+
+	go func() {
+		defer close(done)
+		if t.options.Ordered {
+			<-previous
+		}
+		t.sem <- struct{}{}
+		defer func() { <-t.sem }()
+
+		if err := t.transactor(entities, t.options.Ordered); err != nil {
+			t.mu.Lock()
+			t.errs = append(t.errs, err)
+			t.mu.Unlock()
+		}
+	}()
+}
+
+// Flush sends all buffered entities and waits for all outstanding flushes to
+// finish. It returns the errors of all flushes since the last call to Flush
+func (t *AsyncTransaction) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	t.dispatch()
+	pending := t.pending
+	t.mu.Unlock()
+
+	for _, done := range pending {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	remaining := make([]chan struct{}, 0)
+	for _, done := range t.pending {
+		select {
+		case <-done:
+		default:
+			remaining = append(remaining, done)
+		}
+	}
+	t.pending = remaining
+	err := errors.Join(t.errs...)
+	t.errs = nil
+	return err
+}
+
+// Close flushes all buffered entities and rejects further entities
+func (t *AsyncTransaction) Close(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	return t.Flush(ctx)
+}
+
+// asyncTransactions tracks the AsyncTransactions of a request so the handler
+// can wait for them before sending the final status
+type asyncTransactions struct {
+	mu           sync.Mutex
+	transactions []*AsyncTransaction
+}
+
+func (a *asyncTransactions) add(t *AsyncTransaction) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.transactions = append(a.transactions, t)
+}
+
+func (a *asyncTransactions) close(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	transactions := append([]*AsyncTransaction{}, a.transactions...)
+	a.mu.Unlock()
+
+	errs := make([]error, 0)
+	for _, t := range transactions {
+		errs = append(errs, t.Close(ctx))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncTransactionFlushesOnSize(t *testing.T) {
+	recorder := NewRecordingTransactor("key")
+	tx := NewAsyncTransaction(recorder.Transactor(), AsyncOptions{MaxEntities: 2, FlushInterval: time.Hour, Ordered: true})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := tx.AddEntities(Bar{Name: string(rune('a' + i))}); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := tx.Close(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(recorder.Transactions()) != 3 {
+		t.Errorf("Expected 3 transactions, got %d", len(recorder.Transactions()))
+	}
+	if len(recorder.Entities("bar")) != 5 {
+		t.Errorf("Expected 5 entities, got %d", len(recorder.Entities("bar")))
+	}
+	if err := tx.AddEntities(Bar{}); !errors.Is(err, ErrTransactionClosed) {
+		t.Errorf("Expected ErrTransactionClosed, got %v", err)
+	}
+}
+
+func TestAsyncTransactionFlushesOnInterval(t *testing.T) {
+	recorder := NewRecordingTransactor("")
+	tx := NewAsyncTransaction(recorder.Transactor(), AsyncOptions{FlushInterval: 10 * time.Millisecond})
+
+	_ = tx.AddEntities(Bar{Name: "a"})
+	deadline := time.Now().Add(time.Second)
+	for len(recorder.Transactions()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(recorder.Transactions()) != 1 {
+		t.Errorf("Expected interval to flush entities")
+	}
+}
+
+func TestAsyncTransactionIgnoresStoppedTimer(t *testing.T) {
+	recorder := NewRecordingTransactor("")
+	tx := NewAsyncTransaction(recorder.Transactor(), AsyncOptions{MaxEntities: 2, FlushInterval: 10 * time.Millisecond})
+
+	_ = tx.AddEntities(Bar{Name: "a"})
+	// let the first timer fire and wait for the lock while a full buffer is
+	// dispatched and the next timer is armed
+	tx.mu.Lock()
+	time.Sleep(50 * time.Millisecond)
+	tx.buffer = append(tx.buffer, makeEntity(Bar{Name: "b"}))
+	tx.dispatch()
+	tx.buffer = append(tx.buffer, makeEntity(Bar{Name: "c"}))
+	next := time.AfterFunc(time.Hour, func() {})
+	tx.timer = next
+	tx.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	tx.mu.Lock()
+	buffered, timer := len(tx.buffer), tx.timer
+	tx.mu.Unlock()
+	if buffered != 1 || timer != next {
+		t.Errorf("Expected the stopped timer not to flush the next buffer")
+	}
+	next.Stop()
+}
+
+func TestAsyncTransactionReportsErrors(t *testing.T) {
+	tx := NewAsyncTransaction(func(entities []interface{}, ordered bool) error {
+		return errors.New("failed")
+	}, AsyncOptions{})
+
+	_ = tx.AddEntities(Bar{Name: "a"})
+	if err := tx.Flush(context.Background()); err == nil || err.Error() != "failed" {
+		t.Errorf("Expected flush error, got %v", err)
+	}
+	if err := tx.Flush(context.Background()); err != nil {
+		t.Errorf("Expected errors to be reported once, got %s", err)
+	}
+}
+
+func TestHandlerWaitsForAsyncTransactions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transactions.edn")
+	t.Setenv("ATOMIST_TRANSACT_DRY_RUN", path)
+
+	recorder := &statusRecorder{}
+	statusServer := recorder.server()
+	defer statusServer.Close()
+
+	handler := createHttpHandler(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			tx := req.NewAsyncTransaction(AsyncOptions{FlushInterval: time.Hour})
+			_ = tx.AddEntities(Bar{Name: "pending"})
+			return NewCompletedStatus("done")
+		},
+	}), handlerOptions{})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testEvent("on_push", statusServer.URL)))
+	handler(httptest.NewRecorder(), req)
+
+	bs, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(bs), `"pending"`) {
+		t.Errorf("Expected buffered entities to be flushed before the final status, got %s", string(bs))
+	}
+	if states := recorder.states(); len(states) != 2 || states[1] != Completed {
+		t.Errorf("Expected completed status, got %v", states)
+	}
+}
+
+func TestPanickingHandlerFlushesAsyncTransactions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transactions.edn")
+	t.Setenv("ATOMIST_TRANSACT_DRY_RUN", path)
+
+	recorder := &statusRecorder{}
+	statusServer := recorder.server()
+	defer statusServer.Close()
+
+	handler := createHttpHandler(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			tx := req.NewAsyncTransaction(AsyncOptions{FlushInterval: time.Hour})
+			_ = tx.AddEntities(Bar{Name: "pending"})
+			panic("boom")
+		},
+	}), handlerOptions{})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testEvent("on_push", statusServer.URL)))
+	handler(httptest.NewRecorder(), req)
+
+	bs, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(bs), `"pending"`) {
+		t.Errorf("Expected buffered entities to be flushed after a panic, got %s", string(bs))
+	}
+	if states := recorder.states(); len(states) != 2 || states[1] != Failed {
+		t.Errorf("Expected failed status, got %v", states)
+	}
+}
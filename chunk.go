@@ -0,0 +1,175 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"sort"
+
+	"github.com/atomist-skills/go-skill/internal"
+	"github.com/google/uuid"
+	"olympos.io/encoding/edn"
+)
+
+// ChunkLimits bounds the size of a single transaction sent to the platform.
+// Larger transactions are split into several chunks sharing one ordering key
+type ChunkLimits struct {
+	// MaxEntities is the maximum number of flattened entities per chunk
+	MaxEntities int
+	// MaxBytes is the approximate maximum size of the serialized entities per chunk
+	MaxBytes int
+}
+
+// DefaultChunkLimits is used when no ChunkLimits are configured
+var DefaultChunkLimits = ChunkLimits{
+	MaxEntities: 1000,
+	MaxBytes:    1024 * 1024,
+}
+
+func (l ChunkLimits) orDefault() ChunkLimits {
+	if l.MaxEntities <= 0 && l.MaxBytes <= 0 {
+		return DefaultChunkLimits
+	}
+	return l
+}
+
+// chunkTransaction splits the transaction into chunks within the given limits.
+// Referenced entities are ordered before the entities referencing them so that
+// every reference points into the same or an earlier chunk. All chunks share
+// the same ordering key to have the backend apply them in sequence
+func chunkTransaction(transaction *internal.TransactionEntity, limits ChunkLimits) []internal.TransactionEntity {
+	limits = limits.orDefault()
+	entities := orderReferencedFirst(transaction.Data)
+
+	chunks := make([]internal.TransactionEntity, 0)
+	chunk := make([]map[edn.Keyword]edn.RawMessage, 0)
+	size := 0
+	for _, e := range entities {
+		entitySize := entitySize(e)
+		full := (limits.MaxEntities > 0 && len(chunk) >= limits.MaxEntities) ||
+			(limits.MaxBytes > 0 && size+entitySize > limits.MaxBytes)
+		if full && len(chunk) > 0 {
+			chunks = append(chunks, internal.TransactionEntity{Data: chunk})
+			chunk = make([]map[edn.Keyword]edn.RawMessage, 0)
+			size = 0
+		}
+		chunk = append(chunk, e)
+		size += entitySize
+	}
+	chunks = append(chunks, internal.TransactionEntity{Data: chunk})
+
+	orderingKey := transaction.OrderingKey
+	if orderingKey == "" && len(chunks) > 1 {
+		orderingKey = uuid.NewString()
+	}
+	for i := range chunks {
+		chunks[i].OrderingKey = orderingKey
+	}
+	return chunks
+}
+
+func entitySize(entity map[edn.Keyword]edn.RawMessage) int {
+	size := 2
+	for k, v := range entity {
+		size += len(k) + len(v) + 3
+	}
+	return size
+}
+
+// orderReferencedFirst sorts entities so that referenced entities come before the
+// entities referencing them while otherwise keeping the original order
+func orderReferencedFirst(entities []map[edn.Keyword]edn.RawMessage) []map[edn.Keyword]edn.RawMessage {
+	ids := make(map[string]int, len(entities))
+	for i, e := range entities {
+		if id, ok := entityId(e); ok {
+			ids[id] = i
+		}
+	}
+
+	ordered := make([]map[edn.Keyword]edn.RawMessage, 0, len(entities))
+	visited := make([]bool, len(entities))
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for _, ref := range entityReferences(entities[i]) {
+			if j, ok := ids[ref]; ok {
+				visit(j)
+			}
+		}
+		ordered = append(ordered, entities[i])
+	}
+	for i := range entities {
+		visit(i)
+	}
+	return ordered
+}
+
+// entityId returns the value of schema/entity of the flattened entity
+func entityId(entity map[edn.Keyword]edn.RawMessage) (string, bool) {
+	raw, ok := entity["schema/entity"]
+	if !ok {
+		return "", false
+	}
+	var id string
+	if err := edn.Unmarshal(raw, &id); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// entityReferences returns all strings found in the attribute values of the
+// flattened entity in a stable order
+func entityReferences(entity map[edn.Keyword]edn.RawMessage) []string {
+	keys := make([]string, 0, len(entity))
+	for k := range entity {
+		if k != "schema/entity" && k != "schema/entity-type" {
+			keys = append(keys, string(k))
+		}
+	}
+	sort.Strings(keys)
+
+	refs := make([]string, 0)
+	for _, k := range keys {
+		var value interface{}
+		if err := edn.Unmarshal(entity[edn.Keyword(k)], &value); err == nil {
+			refs = collectStrings(value, refs)
+		}
+	}
+	return refs
+}
+
+func collectStrings(value interface{}, strings []string) []string {
+	switch v := value.(type) {
+	case string:
+		strings = append(strings, v)
+	case []interface{}:
+		for _, e := range v {
+			strings = collectStrings(e, strings)
+		}
+	case map[interface{}]interface{}:
+		for _, e := range v {
+			strings = collectStrings(e, strings)
+		}
+	case map[interface{}]bool:
+		for e := range v {
+			strings = collectStrings(e, strings)
+		}
+	}
+	return strings
+}
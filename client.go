@@ -0,0 +1,173 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atomist-skills/go-skill/environment"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// DefaultClientTimeout bounds every outbound request unless configured otherwise
+const DefaultClientTimeout = 30 * time.Second
+
+// ClientOptions configures all outbound calls to the skill platform
+type ClientOptions struct {
+	// HTTPClient sends all requests; if set, Timeout, Proxy and TLSConfig are ignored
+	HTTPClient *http.Client
+	// Timeout bounds a single request; defaults to DefaultClientTimeout
+	Timeout time.Duration
+	// Proxy selects the proxy of a request; defaults to http.ProxyFromEnvironment
+	Proxy func(*http.Request) (*url.URL, error)
+	// TLSConfig configures TLS, e.g. client certificates for mTLS
+	TLSConfig *tls.Config
+
+	// ScoutURL is the base URL transactions without an incoming event are sent to;
+	// defaults to the production or staging Docker Scout API
+	ScoutURL string
+	// AtomistURL is the base URL of the Atomist API; defaults to https://api.atomist.com
+	AtomistURL string
+
+	// Compression encodes request bodies larger than CompressionThreshold;
+	// defaults to GzipCompression
+	Compression Compression
+	// CompressionThreshold in bytes; defaults to DefaultCompressionThreshold
+	CompressionThreshold int
+
+	// UserAgent is sent with every request; defaults to go-skill
+	UserAgent string
+	// Headers are added to every request
+	Headers http.Header
+	// Propagator injects the trace context of the request context into every
+	// request; defaults to the global otel propagator
+	Propagator propagation.TextMapPropagator
+}
+
+func (o ClientOptions) orDefault() ClientOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultClientTimeout
+	}
+	if o.Proxy == nil {
+		o.Proxy = http.ProxyFromEnvironment
+	}
+	if o.ScoutURL == "" {
+		o.ScoutURL = "https://api.scout.docker.com"
+		if environment.IsStaging() {
+			o.ScoutURL = "https://api.scout-stage.docker.com"
+		}
+	}
+	if o.AtomistURL == "" {
+		o.AtomistURL = "https://api.atomist.com"
+	}
+	o.ScoutURL = strings.TrimSuffix(o.ScoutURL, "/")
+	o.AtomistURL = strings.TrimSuffix(o.AtomistURL, "/")
+	if o.Compression == "" {
+		o.Compression = GzipCompression
+	}
+	if o.CompressionThreshold <= 0 {
+		o.CompressionThreshold = DefaultCompressionThreshold
+	}
+	if o.UserAgent == "" {
+		o.UserAgent = "go-skill"
+	}
+	if o.Propagator == nil {
+		o.Propagator = otel.GetTextMapPropagator()
+	}
+	return o
+}
+
+// Client sends requests to the skill platform as configured by ClientOptions
+type Client struct {
+	options ClientOptions
+	http    *http.Client
+}
+
+// NewClient creates a Client from options
+func NewClient(options ClientOptions) *Client {
+	options = options.orDefault()
+
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = options.Proxy
+		if options.TLSConfig != nil {
+			transport.TLSClientConfig = options.TLSConfig
+		}
+		httpClient = &http.Client{
+			Transport: transport,
+			Timeout:   options.Timeout,
+		}
+	}
+
+	return &Client{
+		options: options,
+		http:    httpClient,
+	}
+}
+
+var defaultClient = sync.OnceValue(func() *Client {
+	return NewClient(ClientOptions{})
+})
+
+// Options returns the options of this Client with all defaults applied
+func (c *Client) Options() ClientOptions {
+	return c.options
+}
+
+// HTTPClient returns the underlying http.Client
+func (c *Client) HTTPClient() *http.Client {
+	return c.http
+}
+
+// NewRequest creates a request carrying the configured user agent and headers
+// as well as the trace context of ctx
+func (c *Client) NewRequest(ctx context.Context, method string, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.options.UserAgent)
+	for k, values := range c.options.Headers {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	c.options.Propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, nil
+}
+
+// Do sends req with the underlying http.Client
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.http.Do(req)
+}
+
+// orDefault returns c or the default Client if c is nil
+func (c *Client) orDefault() *Client {
+	if c == nil {
+		return defaultClient()
+	}
+	return c
+}
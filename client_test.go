@@ -0,0 +1,65 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientOptionsApplyToRemoteTransactions(t *testing.T) {
+	var path, userAgent, header string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		userAgent = req.UserAgent()
+		header = req.Header.Get("X-Test")
+		rw.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientOptions{
+		ScoutURL:  server.URL + "/",
+		UserAgent: "test-skill",
+		Headers:   http.Header{"X-Test": []string{"value"}},
+	})
+	logger := *createDefaultLogger(context.Background(), map[string]string{})
+	event := EventIncoming{WorkspaceId: "T1", Token: "token"}
+
+	err := NewTransactionWithClient(context.Background(), event, logger, client).
+		AddEntities(Bar{Name: "1"}).
+		Transact()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if path != "/v1/skills/remote/T1" {
+		t.Errorf("Expected request to configured ScoutURL, got %s", path)
+	}
+	if userAgent != "test-skill" || header != "value" {
+		t.Errorf("Expected user agent and headers to be set, got %s and %s", userAgent, header)
+	}
+
+	path = ""
+	transactor := NewHttpTransactorWithClient("T2", "token", "", "", logger, client)
+	if err := NewTransaction(context.Background(), transactor).AddEntities(Bar{Name: "2"}).Transact(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if path != "/v1/skills/remote/T2" {
+		t.Errorf("Expected transactor to use the configured ScoutURL, got %s", path)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command skill-gen generates Go entity structs from the datalog schemata of a skill.
+//
+// Use it from go generate:
+//
+//	//go:generate go run github.com/atomist-skills/go-skill/cmd/skill-gen -schema datalog/schema -out entities.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/atomist-skills/go-skill"
+	"github.com/atomist-skills/go-skill/codegen"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "datalog/schema", "schema .edn file or directory of .edn files")
+	specPath := flag.String("spec", "", "skill.yaml to read schemata from instead of -schema")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package of the generated file")
+	out := flag.String("out", "entities.go", "file to write the generated code to")
+	flag.Parse()
+
+	if *pkg == "" {
+		*pkg = "main"
+	}
+
+	var schemata []skill.Schemata
+	var err error
+	if *specPath != "" {
+		schemata, err = schemataFromSpec(*specPath)
+	} else {
+		schemata, err = schemataFromPath(*schemaPath)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	source, err := codegen.Generate(*pkg, schemata...)
+	if err != nil {
+		fail(err)
+	}
+	if err := os.WriteFile(*out, source, 0o644); err != nil {
+		fail(err)
+	}
+}
+
+func schemataFromSpec(path string) ([]skill.Schemata, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := skill.ParseSpec(data)
+	if err != nil {
+		return nil, err
+	}
+
+	schemata := make([]skill.Schemata, 0)
+	for _, spec := range specs {
+		schemata = append(schemata, spec.Schemata...)
+	}
+	return schemata, nil
+}
+
+func schemataFromPath(path string) ([]skill.Schemata, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(path, "*.edn"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	schemata := make([]skill.Schemata, 0, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		schemata = append(schemata, skill.Schemata{
+			Name:   strings.TrimSuffix(filepath.Base(f), ".edn"),
+			Schema: string(data),
+		})
+	}
+	return schemata, nil
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "skill-gen: %s\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package codegen generates Go entity structs from datalog schemata
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/atomist-skills/go-skill"
+	"olympos.io/encoding/edn"
+)
+
+// schema merges the attributes, entity types and enums of all schemata
+type schema struct {
+	attributes  map[edn.Keyword]skill.SchemaAttribute
+	entityTypes map[edn.Keyword]skill.SchemaAttribute
+	enums       map[string][]edn.Keyword
+}
+
+// Generate returns the formatted source of a Go file in package pkg declaring an
+// entity struct for every entity type and constants for all enum values of the
+// provided schemata
+func Generate(pkg string, schemata ...skill.Schemata) ([]byte, error) {
+	s := schema{
+		attributes:  make(map[edn.Keyword]skill.SchemaAttribute),
+		entityTypes: make(map[edn.Keyword]skill.SchemaAttribute),
+		enums:       make(map[string][]edn.Keyword),
+	}
+	for _, schemata := range schemata {
+		parsed, err := skill.ParseSchema(schemata.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse schema %s: %w", schemata.Name, err)
+		}
+		for k, a := range parsed.Attributes {
+			switch {
+			case a.IsEntityType():
+				s.entityTypes[k] = a
+			case a.ValueType == "":
+				// attributes without value type are enum values
+				namespace, _, _ := strings.Cut(string(k), "/")
+				s.enums[namespace] = append(s.enums[namespace], k)
+			default:
+				s.attributes[k] = a
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	imports := make(map[string]bool)
+
+	for _, namespace := range sortedKeys(s.enums) {
+		values := s.enums[namespace]
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		fmt.Fprintf(&body, "// Values of the %s enum\nconst (\n", namespace)
+		for _, v := range values {
+			_, name, _ := strings.Cut(string(v), "/")
+			fmt.Fprintf(&body, "\t%s%s edn.Keyword = %q\n", goName(namespace), goName(name), string(v))
+		}
+		body.WriteString(")\n\n")
+		imports["olympos.io/encoding/edn"] = true
+	}
+
+	for _, entityType := range sortedKeys(s.entityTypes) {
+		e := s.entityTypes[entityType]
+		if e.Doc != "" {
+			fmt.Fprintf(&body, "// %s %s\n", typeName(entityType), e.Doc)
+		} else {
+			fmt.Fprintf(&body, "// %s is an entity of type %s\n", typeName(entityType), string(entityType))
+		}
+		fmt.Fprintf(&body, "type %s struct {\n", typeName(entityType))
+		fmt.Fprintf(&body, "\tskill.Entity `entity-type:%q`\n", string(entityType))
+		imports["github.com/atomist-skills/go-skill"] = true
+		names := fieldNames(e.Attrs)
+		for _, attr := range e.Attrs {
+			a, ok := s.attributes[attr]
+			if !ok {
+				return nil, fmt.Errorf("entity type %s references unknown attribute %s", entityType, attr)
+			}
+			goType, imp := s.fieldType(attr, a)
+			if imp != "" {
+				imports[imp] = true
+			}
+			fmt.Fprintf(&body, "\t%s %s `%s`\n", names[attr], goType, fieldTag(attr, a, goType))
+		}
+		body.WriteString("}\n\n")
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by skill-gen. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if len(imports) > 0 {
+		out.WriteString("import (\n")
+		// standard library imports first
+		for _, std := range []bool{true, false} {
+			for _, imp := range sortedKeys(imports) {
+				if !strings.Contains(imp, ".") == std {
+					fmt.Fprintf(&out, "\t%q\n", imp)
+				}
+			}
+			out.WriteString("\n")
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(body.Bytes())
+
+	return format.Source(out.Bytes())
+}
+
+// fieldNames names the struct fields of attrs by the attribute name. Attributes
+// whose names collide with each other or the embedded Entity are prefixed with
+// their namespace, e.g. foo.bar/name and foo.baz/name become FooBarName and FooBazName
+func fieldNames(attrs []edn.Keyword) map[edn.Keyword]string {
+	count := map[string]int{"Entity": 1}
+	for _, attr := range attrs {
+		_, name, _ := strings.Cut(string(attr), "/")
+		count[goName(name)]++
+	}
+
+	names := make(map[edn.Keyword]string, len(attrs))
+	for _, attr := range attrs {
+		_, name, _ := strings.Cut(string(attr), "/")
+		if count[goName(name)] > 1 {
+			names[attr] = typeName(attr)
+		} else {
+			names[attr] = goName(name)
+		}
+	}
+	return names
+}
+
+// fieldType maps an attribute to its Go type and the import that type requires
+func (s schema) fieldType(attr edn.Keyword, a skill.SchemaAttribute) (string, string) {
+	many := a.IsMany()
+	if a.ValueType == "db.type/ref" {
+		namespace, name, _ := strings.Cut(string(attr), "/")
+		if _, ok := s.enums[namespace+"."+name]; ok {
+			return sliceOf("edn.Keyword", many), "olympos.io/encoding/edn"
+		}
+		if target, ok := s.refTarget(attr); ok {
+			if many {
+				return "[]" + typeName(target), ""
+			}
+			return "*" + typeName(target), ""
+		}
+		if many {
+			return "*skill.ManyRef", ""
+		}
+		return "string", ""
+	}
+
+	switch a.ValueType {
+	case "db.type/keyword":
+		return sliceOf("edn.Keyword", many), "olympos.io/encoding/edn"
+	case "db.type/boolean":
+		return sliceOf("bool", many), ""
+	case "db.type/long", "db.type/bigint":
+		return sliceOf("int64", many), ""
+	case "db.type/float", "db.type/double", "db.type/bigdec":
+		return sliceOf("float64", many), ""
+	case "db.type/instant":
+		if many {
+			return "[]time.Time", "time"
+		}
+		return "*time.Time", "time"
+	case "db.type/tuple":
+		return sliceOf("[]interface{}", many), ""
+	default:
+		return sliceOf("string", many), ""
+	}
+}
+
+// refTarget finds the entity type a ref attribute points at by its name, e.g.
+// docker.image/repository references docker/repository
+func (s schema) refTarget(attr edn.Keyword) (edn.Keyword, bool) {
+	namespace, name, _ := strings.Cut(string(attr), "/")
+	root, _, _ := strings.Cut(namespace, ".")
+	if _, ok := s.entityTypes[edn.Keyword(root+"/"+name)]; ok {
+		return edn.Keyword(root + "/" + name), true
+	}
+
+	var candidates []edn.Keyword
+	for entityType := range s.entityTypes {
+		if strings.HasSuffix(string(entityType), "/"+name) {
+			candidates = append(candidates, entityType)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	return "", false
+}
+
+func fieldTag(attr edn.Keyword, a skill.SchemaAttribute, goType string) string {
+	if a.Unique == "db.unique/identity" {
+		return fmt.Sprintf(`edn:"%s" identity:"true"`, string(attr))
+	}
+	if goType == "bool" {
+		return fmt.Sprintf(`edn:"%s"`, string(attr))
+	}
+	return fmt.Sprintf(`edn:"%s,omitempty"`, string(attr))
+}
+
+func sliceOf(goType string, many bool) string {
+	if many {
+		return "[]" + goType
+	}
+	return goType
+}
+
+// typeName turns an entity type like git.commit/signature into GitCommitSignature
+func typeName(entityType edn.Keyword) string {
+	namespace, name, _ := strings.Cut(string(entityType), "/")
+	return goName(namespace) + goName(name)
+}
+
+// goName turns a dotted or dashed keyword part like source-id into SourceId.
+// Characters not allowed in Go identifiers, like the ? of predicates, separate
+// words as well, and names starting with a digit are prefixed with an X
+func goName(s string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		r, size := utf8.DecodeRuneInString(part)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(part[size:])
+	}
+	name := b.String()
+	if r, _ := utf8.DecodeRuneInString(name); unicode.IsDigit(r) {
+		name = "X" + name
+	}
+	return name
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
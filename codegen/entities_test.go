@@ -0,0 +1,170 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package codegen
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/atomist-skills/go-skill"
+)
+
+const testSchema = `{:attributes
+ {:docker/image {:db.entity/attrs [:docker.image/digest :docker.image/tags :docker.image/repository
+                                   :docker.image/layers :docker.image/created-at :docker.image/status]}
+  :docker.image/digest {:db/valueType :db.type/string
+                        :db/cardinality :db.cardinality/one
+                        :db/unique :db.unique/identity}
+  :docker.image/tags {:db/valueType :db.type/string
+                      :db/cardinality :db.cardinality/many}
+  :docker.image/repository {:db/valueType :db.type/ref
+                            :db/cardinality :db.cardinality/one}
+  :docker.image/layers {:db/valueType :db.type/ref
+                        :db/cardinality :db.cardinality/many}
+  :docker.image/created-at {:db/valueType :db.type/instant
+                            :db/cardinality :db.cardinality/one}
+  :docker.image/status {:db/valueType :db.type/ref
+                        :db/cardinality :db.cardinality/one}
+  :docker.image.status/pending {}
+  :docker.image.status/ready {}
+  :docker/repository {:db.entity/attrs [:docker.repository/host]}
+  :docker.repository/host {:db/valueType :db.type/string
+                           :db/cardinality :db.cardinality/one}}}`
+
+func TestGenerate(t *testing.T) {
+	source, err := Generate("entities", skill.Schemata{Name: "docker", Schema: testSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"package entities",
+		`DockerImageStatusPending edn.Keyword = "docker.image.status/pending"`,
+		"type DockerImage struct {",
+		"skill.Entity `entity-type:\"docker/image\"`",
+		"Digest     string            `edn:\"docker.image/digest\" identity:\"true\"`",
+		"Tags       []string          `edn:\"docker.image/tags,omitempty\"`",
+		"Repository *DockerRepository `edn:\"docker.image/repository,omitempty\"`",
+		"Layers     *skill.ManyRef    `edn:\"docker.image/layers,omitempty\"`",
+		"CreatedAt  *time.Time        `edn:\"docker.image/created-at,omitempty\"`",
+		"Status     edn.Keyword       `edn:\"docker.image/status,omitempty\"`",
+		"type DockerRepository struct {",
+	}
+	// ignore the alignment of struct fields
+	normalized := strings.Join(strings.Fields(string(source)), " ")
+	for _, e := range expected {
+		if !strings.Contains(normalized, strings.Join(strings.Fields(e), " ")) {
+			t.Errorf("Expected generated code to contain %q:\n%s", e, source)
+		}
+	}
+}
+
+// typeCheck compiles the generated source reporting unused imports and duplicate fields
+func typeCheck(t *testing.T, source []byte) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "entities.go", source, 0)
+	if err != nil {
+		t.Fatalf("Failed to parse generated code: %s\n%s", err, source)
+	}
+	config := types.Config{Importer: stubImporter{
+		"github.com/atomist-skills/go-skill": stubPackage("github.com/atomist-skills/go-skill", "skill", map[string]types.Type{
+			"Entity":  types.NewStruct(nil, nil),
+			"ManyRef": types.NewStruct(nil, nil),
+		}),
+		"olympos.io/encoding/edn": stubPackage("olympos.io/encoding/edn", "edn", map[string]types.Type{
+			"Keyword": types.Typ[types.String],
+		}),
+	}}
+	if _, err := config.Check("entities", fset, []*ast.File{file}, nil); err != nil {
+		t.Errorf("Generated code does not compile: %s\n%s", err, source)
+	}
+}
+
+// stubImporter resolves the dependencies of generated code to stubs declaring
+// only the types it uses, which is much faster than type checking them
+type stubImporter map[string]*types.Package
+
+func (i stubImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := i[path]; ok {
+		return pkg, nil
+	}
+	return importer.Default().Import(path)
+}
+
+func stubPackage(path string, name string, typeNames map[string]types.Type) *types.Package {
+	pkg := types.NewPackage(path, name)
+	for n, underlying := range typeNames {
+		obj := types.NewTypeName(token.NoPos, pkg, n, nil)
+		types.NewNamed(obj, underlying, nil)
+		pkg.Scope().Insert(obj)
+	}
+	pkg.MarkComplete()
+	return pkg
+}
+
+func TestGenerateCompiles(t *testing.T) {
+	for name, schema := range map[string]string{
+		"docker": testSchema,
+		"enums only": `{:attributes
+ {:foo.bar.status/pending {}
+  :foo.bar.status/ready {}}}`,
+		"predicates": `{:attributes
+ {:vuln/advisory {:db.entity/attrs [:vuln.advisory/withdrawn? :vuln.advisory/cvss*score :vuln.advisory/3rd-party!]}
+  :vuln.advisory/withdrawn? {:db/valueType :db.type/boolean
+                             :db/cardinality :db.cardinality/one}
+  :vuln.advisory/cvss*score {:db/valueType :db.type/double
+                             :db/cardinality :db.cardinality/one}
+  :vuln.advisory/3rd-party! {:db/valueType :db.type/boolean
+                             :db/cardinality :db.cardinality/one}
+  :vuln.advisory.state/in-review? {}}}`,
+		"colliding names": `{:attributes
+ {:foo/bar {:db.entity/attrs [:foo.bar/name :foo.baz/name :foo.bar/entity]}
+  :foo.bar/name {:db/valueType :db.type/string
+                 :db/cardinality :db.cardinality/one}
+  :foo.baz/name {:db/valueType :db.type/string
+                 :db/cardinality :db.cardinality/one}
+  :foo.bar/entity {:db/valueType :db.type/string
+                   :db/cardinality :db.cardinality/one}}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			source, err := Generate("entities", skill.Schemata{Name: name, Schema: schema})
+			if err != nil {
+				t.Fatal(err)
+			}
+			typeCheck(t, source)
+		})
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for keyword, expected := range map[string]string{
+		"source-id":  "SourceId",
+		"withdrawn?": "Withdrawn",
+		"cvss*score": "CvssScore",
+		"3rd-party!": "X3rdParty",
+	} {
+		if name := goName(keyword); name != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, keyword, name)
+		}
+	}
+}
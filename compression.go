@@ -0,0 +1,106 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	"olympos.io/encoding/edn"
+)
+
+// Compression is the Content-Encoding of request bodies sent to the platform
+type Compression string
+
+const (
+	NoCompression   Compression = "identity"
+	GzipCompression Compression = "gzip"
+	ZstdCompression Compression = "zstd"
+)
+
+// DefaultCompressionThreshold is the body size in bytes above which request
+// bodies are compressed
+const DefaultCompressionThreshold = 64 * 1024
+
+// compress encodes bs with the configured compression if it exceeds the
+// threshold. It returns the body and its Content-Encoding, if any
+func (c *Client) compress(bs []byte) ([]byte, string, error) {
+	if c.options.Compression == NoCompression || len(bs) <= c.options.CompressionThreshold {
+		return bs, "", nil
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch c.options.Compression {
+	case GzipCompression:
+		w = gzip.NewWriter(&buf)
+	case ZstdCompression:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, "", err
+		}
+		w = zw
+	default:
+		return nil, "", fmt.Errorf("unsupported compression %s", c.options.Compression)
+	}
+
+	if _, err := w.Write(bs); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), string(c.options.Compression), nil
+}
+
+// DecodeRequestBody returns the body of r decoded according to its
+// Content-Encoding. Local stand-ins of the platform use it to read compressed
+// transactions and statuses
+func DecodeRequestBody(r *http.Request) (io.ReadCloser, error) {
+	switch r.Header.Get("Content-Encoding") {
+	case "", string(NoCompression):
+		return r.Body, nil
+	case string(GzipCompression):
+		return gzip.NewReader(r.Body)
+	case string(ZstdCompression):
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %s", r.Header.Get("Content-Encoding"))
+	}
+}
+
+// prettyEDN returns bs pretty printed if debug logging is enabled. It returns a
+// plain string as loggers passed in by users don't expand lazily evaluated args
+func prettyEDN(bs []byte) string {
+	if !Log.IsLevelEnabled(logrus.DebugLevel) {
+		return string(bs)
+	}
+	var buf bytes.Buffer
+	if err := edn.PPrint(&buf, bs, nil); err != nil {
+		return string(bs)
+	}
+	return buf.String()
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestTransactionsAreCompressed(t *testing.T) {
+	for _, compression := range []Compression{GzipCompression, ZstdCompression} {
+		var encoding, body string
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			encoding = req.Header.Get("Content-Encoding")
+			rc, err := DecodeRequestBody(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			bs, _ := io.ReadAll(rc)
+			body = string(bs)
+			rw.WriteHeader(202)
+		}))
+
+		logger := *createDefaultLogger(context.Background(), map[string]string{})
+		options := transactOptions{client: NewClient(ClientOptions{Compression: compression, CompressionThreshold: 10})}
+		err := newTransactionFromRequest(context.Background(), transactionEvent(server.URL), logger, options).
+			AddEntities(Bar{Name: strings.Repeat("x", 100)}).
+			Transact()
+		server.Close()
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if encoding != string(compression) {
+			t.Errorf("Expected %s encoding, got %q", compression, encoding)
+		}
+		if !strings.Contains(body, strings.Repeat("x", 100)) || strings.Contains(body, "\n") {
+			t.Errorf("Expected compact EDN body, got %s", body)
+		}
+	}
+}
+
+func TestSmallBodiesAreNotCompressed(t *testing.T) {
+	bs, encoding, err := NewClient(ClientOptions{}).compress([]byte("{:status {:state :completed}}"))
+	if err != nil || encoding != "" || string(bs) != "{:status {:state :completed}}" {
+		t.Errorf("Expected small body to be sent as is, got %s %s %v", bs, encoding, err)
+	}
+}
+
+func TestUserLoggersReceiveStatusEDN(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	level := Log.GetLevel()
+	defer Log.SetLevel(level)
+	for _, l := range []logrus.Level{logrus.InfoLevel, logrus.DebugLevel} {
+		Log.SetLevel(l)
+		var logged []string
+		logger := Logger{Debugf: func(format string, a ...any) {
+			logged = append(logged, fmt.Sprintf(format, a...))
+		}}
+		var event EventIncoming
+		event.Urls.Execution = server.URL
+		if err := SendEventStatus(context.Background(), event, logger, NewCompletedStatus("logged")); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(logged) == 0 || !strings.Contains(logged[0], `"logged"`) {
+			t.Errorf("Expected the status EDN to be logged at %s, got %v", l, logged)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+type contextKey int
+
+const (
+	eventContextKey contextKey = iota
+	loggerContextKey
+	transactionFactoryContextKey
+)
+
+// TransactionFactory creates a new Transaction for the current request
+type TransactionFactory func() Transaction
+
+// NewContext returns a copy of ctx carrying the incoming event, the logger and a
+// TransactionFactory of the provided RequestContext
+func NewContext(ctx context.Context, req *RequestContext) context.Context {
+	ctx = context.WithValue(ctx, eventContextKey, req.Event)
+	ctx = context.WithValue(ctx, loggerContextKey, req.Log)
+	ctx = context.WithValue(ctx, transactionFactoryContextKey, TransactionFactory(req.NewTransaction))
+	return ctx
+}
+
+// EventFromContext returns the incoming event stored in ctx
+func EventFromContext(ctx context.Context) (EventIncoming, bool) {
+	event, ok := ctx.Value(eventContextKey).(EventIncoming)
+	return event, ok
+}
+
+// LoggerFromContext returns the request logger stored in ctx, falling back to a
+// logger without any request labels
+func LoggerFromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(Logger); ok {
+		return logger
+	}
+	return *createDefaultLogger(ctx, map[string]string{})
+}
+
+// TransactionFactoryFromContext returns the TransactionFactory stored in ctx
+func TransactionFactoryFromContext(ctx context.Context) (TransactionFactory, bool) {
+	factory, ok := ctx.Value(transactionFactoryContextKey).(TransactionFactory)
+	return factory, ok
+}
+
+// ExecutionTimeoutParameter is the skill configuration parameter overriding the
+// execution timeout of a handler, either as duration like "10m" or in seconds
+const ExecutionTimeoutParameter = "execution-timeout"
+
+// executionTimeout reads the execution timeout from the skill configuration of
+// event, falling back to the provided timeout
+func executionTimeout(event EventIncoming, fallback time.Duration) time.Duration {
+	for _, p := range configurationFromEvent(event).Parameters {
+		if p.Name != ExecutionTimeoutParameter {
+			continue
+		}
+		switch v := p.Value.(type) {
+		case string:
+			if timeout, err := time.ParseDuration(v); err == nil {
+				return timeout
+			}
+		case int64:
+			return time.Duration(v) * time.Second
+		}
+		Log.Warnf("Ignoring invalid %s parameter: %v", ExecutionTimeoutParameter, p.Value)
+	}
+	return fallback
+}
+
+// configurationFromEvent returns the skill configuration the event was sent for
+func configurationFromEvent(event EventIncoming) Configuration {
+	switch event.Type {
+	case EventTypeSubscription:
+		return event.Context.Subscription.Configuration
+	case EventTypeWebhook:
+		return event.Context.Webhook.Configuration
+	case EventTypeQueryResult:
+		return event.Context.AsyncQueryResult.Configuration
+	case EventTypeSyncRequest:
+		return event.Context.SyncRequest.Configuration
+	}
+	return Configuration{}
+}
+
+// executionTimeoutFromEnv reads the default execution timeout from $ATOMIST_EXECUTION_TIMEOUT
+func executionTimeoutFromEnv() time.Duration {
+	if v, ok := os.LookupEnv("ATOMIST_EXECUTION_TIMEOUT"); ok {
+		if timeout, err := time.ParseDuration(v); err == nil {
+			return timeout
+		}
+		Log.Warnf("Ignoring invalid ATOMIST_EXECUTION_TIMEOUT: %s", v)
+	}
+	return 0
+}
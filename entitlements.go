@@ -0,0 +1,56 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// CheckEntitlements asks the platform whether the workspace of the incoming event
+// is entitled to run the skill. The entitlements url of the event is queried with
+// the event token; a 2xx response grants the entitlement while 402 and 403 deny it.
+// Events without an entitlements url are always entitled
+func CheckEntitlements(ctx context.Context, req RequestContext) (bool, error) {
+	url := req.Event.Urls.Entitlements
+	if url == "" {
+		return true, nil
+	}
+
+	client := req.transactOptions.client.orDefault()
+	resp, attempts, err := doWithRetry(ctx, client.HTTPClient(), req.transactOptions.retryPolicy, req.Log, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := client.NewRequest(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+req.Event.Token)
+		return httpReq, nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("error checking entitlements after %d attempts: %w", attempts, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return true, nil
+	case resp.StatusCode == http.StatusPaymentRequired || resp.StatusCode == http.StatusForbidden:
+		return false, nil
+	}
+	return false, fmt.Errorf("error checking entitlements: %d %s", resp.StatusCode, readErrorBody(resp))
+}
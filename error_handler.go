@@ -0,0 +1,61 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrorHandler handles an event returning the reason of a completed execution
+// or the error it failed with
+type ErrorHandler func(ctx context.Context, req RequestContext) (string, error)
+
+// FromErrorHandler adapts an ErrorHandler to an EventHandler. A nil error results
+// in a completed status with the returned reason; errors are mapped by
+// StatusFromError, i.e. retryable errors like types.RetryableExecutionError
+// result in a retryable status and all others in a failed one
+func FromErrorHandler(handler ErrorHandler) EventHandler {
+	return func(ctx context.Context, req RequestContext) Status {
+		reason, err := handler(ctx, req)
+		if err == nil {
+			return NewCompletedStatus(reason)
+		}
+
+		status := StatusFromError(err)
+		status.Reason = errorChain(err)
+		if status.State == Retryable {
+			req.Log.Warnf("Handler '%s' failed and will be retried: %s", NameFromEvent(req.Event), status.Reason)
+		} else {
+			req.Log.Errorf("Handler '%s' failed: %s", NameFromEvent(req.Event), status.Reason)
+		}
+		return status
+	}
+}
+
+// errorChain describes err followed by the errors it wraps whose message isn't
+// already part of it
+func errorChain(err error) string {
+	msg := err.Error()
+	for e := errors.Unwrap(err); e != nil; e = errors.Unwrap(e) {
+		if m := e.Error(); !strings.Contains(msg, m) {
+			msg += ": " + m
+		}
+	}
+	return msg
+}
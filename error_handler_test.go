@@ -0,0 +1,73 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/atomist-skills/go-skill/policy/types"
+)
+
+type wrappingError struct {
+	err error
+}
+
+func (e wrappingError) Error() string {
+	return "query failed"
+}
+
+func (e wrappingError) Unwrap() error {
+	return e.err
+}
+
+func TestFromErrorHandler(t *testing.T) {
+	var logged []string
+	req := RequestContext{Log: Logger{
+		Warnf: func(format string, a ...any) {
+			logged = append(logged, fmt.Sprintf(format, a...))
+		},
+		Errorf: func(format string, a ...any) {
+			logged = append(logged, fmt.Sprintf(format, a...))
+		},
+	}}
+
+	handle := func(reason string, err error) Status {
+		return FromErrorHandler(func(ctx context.Context, req RequestContext) (string, error) {
+			return reason, err
+		})(context.Background(), req)
+	}
+
+	if status := handle("Indexed image", nil); status.State != Completed || status.Reason != "Indexed image" {
+		t.Errorf("Expected completed status, got %+v", status)
+	}
+
+	status := handle("", fmt.Errorf("evaluating policy: %w", types.RetryableExecutionError("timeout")))
+	if status.State != Retryable || status.Reason != "evaluating policy: timeout" {
+		t.Errorf("Expected retryable status, got %+v", status)
+	}
+
+	status = handle("", fmt.Errorf("evaluating policy: %w", wrappingError{errors.New("connection refused")}))
+	if status.State != Failed || status.Reason != "evaluating policy: query failed: connection refused" {
+		t.Errorf("Expected failed status with the error chain, got %+v", status)
+	}
+	if len(logged) != 2 || logged[1] != "Handler '' failed: evaluating policy: query failed: connection refused" {
+		t.Errorf("Expected the error chain to be logged, got %v", logged)
+	}
+}
@@ -21,26 +21,25 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"runtime/debug"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"olympos.io/encoding/edn"
 )
 
 // Start initiates startup of the skills given the provided Handlers
 func Start(handlers Handlers) {
-	Log.Info("Starting skill...")
-	http.HandleFunc("/", CreateHttpHandlerWithLogger(handlers, nil))
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	StartWithOptions(handlers, ServerOptions{})
+}
 
-	Log.Debugf("Listening on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+// StartWithOptions initiates startup of the skills given the provided Handlers and
+// ServerOptions. It returns after the server has been shut down gracefully
+func StartWithOptions(handlers Handlers, options ServerOptions) {
+	Log.Info("Starting skill...")
+	if err := NewServer(handlers, options).Start(); err != nil {
 		Log.Fatal(err)
 	}
 }
@@ -50,44 +49,90 @@ func CreateHttpHandler(handlers Handlers) func(http.ResponseWriter, *http.Reques
 }
 
 func CreateHttpHandlerWithLogger(handlers Handlers, loggerCreator CreateLogger) func(http.ResponseWriter, *http.Request) {
+	return createHttpHandler(handlers, handlerOptions{
+		loggerCreator:    loggerCreator,
+		platformLogs:     platformLogsFromEnv(),
+		executionTimeout: executionTimeoutFromEnv(),
+	})
+}
+
+// statusTimeout bounds sending a status including its retries, as statuses are
+// sent independently of the request context
+const statusTimeout = 30 * time.Second
+
+// handlerOptions configures the http handler created by createHttpHandler
+type handlerOptions struct {
+	loggerCreator    CreateLogger
+	platformLogs     *PlatformLogOptions
+	executionTimeout time.Duration
+	progressInterval time.Duration
+	transactOptions  transactOptions
+	executions       *executions
+}
+
+func createHttpHandler(handlers Handlers, options handlerOptions) func(http.ResponseWriter, *http.Request) {
+	executions := options.executions
+	telemetry := options.transactOptions.telemetry.orDefault()
 	return func(w http.ResponseWriter, r *http.Request) {
 		handleStart := time.Now()
-		buf := new(strings.Builder)
-		rc := r.Body
-		defer rc.Close()
-		_, err := io.Copy(buf, rc)
-		if err != nil {
-			w.WriteHeader(201)
-			return
-		}
-		body := buf.String()
+		defer r.Body.Close()
+		parent := telemetry.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
 
-		var event EventIncoming
-		err = edn.NewDecoder(strings.NewReader(body)).Decode(&event)
+		_, decodeSpan := telemetry.start(parent, "decode", nil)
+		event, body, err := decodeEvent(r)
+		endSpan(decodeSpan, err)
 		if err != nil {
 			w.WriteHeader(201)
 			return
 		}
 
 		name := NameFromEvent(event)
-		ctx := context.Background()
-		logger := createLogger(ctx, event, r.Header, loggerCreator)
+		ctx, span := telemetry.start(parent, "handle "+name, eventAttributes(event), trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		// the logger and the statuses have to outlive a cancelled request
+		detached := context.WithoutCancel(ctx)
+		logger := createLogger(detached, event, r.Header, options.loggerCreator, options.platformLogs)
 		req := RequestContext{
 			Event: event,
 			Log:   logger,
 
-			ctx: ctx,
+			transactOptions:   options.transactOptions,
+			asyncTransactions: &asyncTransactions{},
+			progress:          newProgressReporter(options.progressInterval),
 		}
+		ctx = NewContext(ctx, &req)
+		if timeout := executionTimeout(event, options.executionTimeout); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		req.ctx = ctx
+		execution := executions.start(req)
+		defer executions.finish(execution)
 
 		logger.Debugf("Skill request parsed in %d ms", time.Now().UnixMilli()-handleStart.UnixMilli())
 
+		// complete waits for outstanding flushes and then sends the final status.
+		// Both are bounded by statusTimeout instead of ctx, which might already be
+		// cancelled by the execution timeout
+		complete := func(status Status) (Status, error) {
+			statusCtx, cancel := context.WithTimeout(detached, statusTimeout)
+			defer cancel()
+			if err := req.asyncTransactions.close(statusCtx); err != nil {
+				logger.Errorf("Failed to flush transactions: %s", err)
+				if status.State == Completed {
+					status = NewFailedStatus(fmt.Sprintf("Failed to transact entities: %s", err))
+				}
+			}
+			return status, execution.complete(statusCtx, status)
+		}
+
 		defer func() {
 			if err := recover(); err != nil {
-				SendStatus(ctx, req, Status{
-					State:  Failed,
-					Reason: fmt.Sprintf("Unsuccessfully invoked handler %s/%s@%s", event.Skill.Namespace, event.Skill.Name, name),
-				})
-				w.WriteHeader(201)
+				_, statusErr := complete(NewFailedStatus(
+					fmt.Sprintf("Unsuccessfully invoked handler %s/%s@%s: %v", event.Skill.Namespace, event.Skill.Name, name, err),
+				).WithError("panic", InternalError))
+				w.WriteHeader(completionCode(logger, statusErr))
 				logger.Errorf("Unhandled error occurred: %v", err)
 				logger.Debugf("Unhandled error stack trace: %s", string(debug.Stack()))
 				return
@@ -105,42 +150,69 @@ func CreateHttpHandlerWithLogger(handlers Handlers, loggerCreator CreateLogger)
 			logger.Debugf("Skill execution took %d ms", time.Now().UnixMilli()-start.UnixMilli())
 		}()
 
-		if handle, ok := handlers(name); ok {
+		handle, ok := handlers(name)
+		if ok {
 			logger.Debugf("Invoking event handler '%s'", name)
 
-			err = SendStatus(ctx, req, Status{
-				State: running,
-			})
+			// the handler still runs if only the running status couldn't be sent
+			statusCtx, cancel := context.WithTimeout(detached, statusTimeout)
+			err = SendStatus(statusCtx, req, NewRunningStatus(""))
+			cancel()
 			if err != nil {
-				Log.Panicf("Failed to send status: %s", err)
+				logger.Warnf("Failed to send running status: %s", err)
 			}
 
-			status := handle(ctx, req)
+			status, err := complete(handle(ctx, req))
+			if req.Event.Type != "sync-request" || err != nil {
+				w.WriteHeader(completionCode(logger, err))
+				return
+			}
 
-			err = SendStatus(ctx, req, status)
+			b, err := edn.Marshal(struct {
+				Result interface{} `edn:"result"`
+			}{
+				Result: status.SyncRequest,
+			})
 			if err != nil {
-				Log.Panicf("Failed to send status: %s", err)
+				logger.Errorf("Failed to marshal result of sync-request: %s", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
 			}
 			w.WriteHeader(201)
-
-			if req.Event.Type == "sync-request" {
-				r := struct {
-					Result interface{} `edn:"result"`
-				}{
-					Result: status.SyncRequest,
-				}
-				b, err := edn.Marshal(r)
-				if err != nil {
-					Log.Panicf("Failed to edn result in sync-request: %s", err)
-				}
-				w.Write(b)
-			}
+			w.Write(b)
 		} else {
-			err = SendStatus(ctx, req, Status{
-				State:  Failed,
-				Reason: fmt.Sprintf("Event handler '%s' not found", name),
-			})
-			w.WriteHeader(201)
+			status := NewFailedStatus(fmt.Sprintf("Event handler '%s' not found", name))
+			if handle != nil {
+				status = handle(ctx, req)
+			}
+			_, err = complete(status)
+			w.WriteHeader(completionCode(logger, err))
 		}
 	}
 }
+
+// completionCode tells the platform whether the final status of an execution
+// was sent; a failure is logged
+func completionCode(logger Logger, err error) int {
+	if err != nil {
+		logger.Errorf("Failed to send status: %s", err)
+		return http.StatusInternalServerError
+	}
+	return 201
+}
+
+// decodeEvent reads the incoming event and returns it with its raw body
+func decodeEvent(r *http.Request) (EventIncoming, string, error) {
+	var event EventIncoming
+	rc, err := DecodeRequestBody(r)
+	if err != nil {
+		return event, "", err
+	}
+	buf := new(strings.Builder)
+	if _, err := io.Copy(buf, rc); err != nil {
+		return event, "", err
+	}
+	body := buf.String()
+	err = edn.NewDecoder(strings.NewReader(body)).Decode(&event)
+	return event, body, err
+}
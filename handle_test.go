@@ -17,8 +17,12 @@
 package skill
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"olympos.io/encoding/edn"
 )
@@ -35,3 +39,55 @@ func TestUnmarshal(t *testing.T) {
 		t.Failed()
 	}
 }
+
+func TestHandlerContext(t *testing.T) {
+	recorder := &statusRecorder{}
+	statusServer := recorder.server()
+	defer statusServer.Close()
+
+	handler := createHttpHandler(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			if event, ok := EventFromContext(ctx); !ok || event.ExecutionId != "1" {
+				t.Errorf("Expected event in context")
+			}
+			if _, ok := TransactionFactoryFromContext(ctx); !ok {
+				t.Errorf("Expected transaction factory in context")
+			}
+			if _, ok := ctx.Deadline(); !ok {
+				t.Errorf("Expected execution timeout to be set")
+			}
+			if ctx.Value(requestKey{}) != "value" {
+				t.Errorf("Expected context to be derived from the request")
+			}
+			return NewCompletedStatus("done")
+		},
+	}), handlerOptions{executionTimeout: time.Minute})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testEvent("on_push", statusServer.URL)))
+	req = req.WithContext(context.WithValue(req.Context(), requestKey{}, "value"))
+	handler(httptest.NewRecorder(), req)
+
+	if states := recorder.states(); len(states) != 2 || states[1] != Completed {
+		t.Errorf("Expected completed status, got %v", states)
+	}
+}
+
+type requestKey struct{}
+
+func TestExecutionTimeoutFromConfiguration(t *testing.T) {
+	var event EventIncoming
+	event.Type = EventTypeSubscription
+	if timeout := executionTimeout(event, time.Minute); timeout != time.Minute {
+		t.Errorf("Expected fallback timeout, got %s", timeout)
+	}
+
+	event.Context.Subscription.Configuration.Parameters = []ParameterValue{{Name: ExecutionTimeoutParameter, Value: "10m"}}
+	if timeout := executionTimeout(event, time.Minute); timeout != 10*time.Minute {
+		t.Errorf("Expected configured timeout, got %s", timeout)
+	}
+
+	event.Context.Subscription.Configuration.Parameters[0].Value = int64(30)
+	if timeout := executionTimeout(event, time.Minute); timeout != 30*time.Second {
+		t.Errorf("Expected configured timeout in seconds, got %s", timeout)
+	}
+}
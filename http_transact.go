@@ -18,29 +18,33 @@ package skill
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
 
-	"github.com/atomist-skills/go-skill/environment"
 	"github.com/atomist-skills/go-skill/internal"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 	"olympos.io/encoding/edn"
 )
 
-func createHttpMessageSender(workspace string, apikey string, correlationId string, logger Logger) messageSender {
+func createHttpMessageSender(ctx context.Context, workspace string, apikey string, correlationId string, logger Logger, options transactOptions) messageSender {
 	return messageSender{
 		Transact: func(entities interface{}) error {
-			return httpTransact(entities, "", workspace, apikey, correlationId, logger)
+			return httpTransact(ctx, entities, "", workspace, apikey, correlationId, logger, options)
 		},
 		TransactOrdered: func(entities interface{}, orderingKey string) error {
-			return httpTransact(entities, orderingKey, workspace, apikey, correlationId, logger)
+			return httpTransact(ctx, entities, orderingKey, workspace, apikey, correlationId, logger, options)
 		},
 	}
 }
 
-func httpTransact(entities interface{}, orderingKey string, workspace string, apikey string, correlationId string, logger Logger) error {
+func httpTransact(ctx context.Context, entities interface{}, orderingKey string, workspace string, apikey string, correlationId string, logger Logger, options transactOptions) (err error) {
+	ctx, span := options.telemetry.orDefault().start(ctx, "transact", []attribute.KeyValue{workspaceKey.String(workspace)})
+	defer func() { endSpan(span, err) }()
+
 	var entityArray []interface{}
 	rt := reflect.TypeOf(entities)
 	switch rt.Kind() {
@@ -51,13 +55,33 @@ func httpTransact(entities interface{}, orderingKey string, workspace string, ap
 		entityArray = []any{entities}
 	}
 
-	transactions, err := makeTransaction(entityArray, orderingKey)
+	transactions, conflicts, err := makeTransaction(entityArray, orderingKey)
 	if err != nil {
 		return err
 	}
+	for _, c := range conflicts {
+		logger.Warnf("Ignoring conflicting value for %s", c)
+	}
+
+	chunks := chunkTransaction(transactions, options.chunkLimits)
+	for i, chunk := range chunks {
+		if len(chunks) > 1 {
+			logger.Debugf("Transacting chunk %d/%d", i+1, len(chunks))
+		}
+		err = httpTransactChunk(ctx, chunk, workspace, apikey, correlationId, logger, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-	flattenedEntities := transactions.Data
-	bs, err := edn.MarshalPPrint(flattenedEntities, nil)
+func httpTransactChunk(ctx context.Context, transaction internal.TransactionEntity, workspace string, apikey string, correlationId string, logger Logger, options transactOptions) error {
+	client := options.client.orDefault()
+	orderingKey := transaction.OrderingKey
+	flattenedEntities := transaction.Data
+	bs, err := edn.Marshal(flattenedEntities)
 	if err != nil {
 		return err
 	}
@@ -80,34 +104,41 @@ func httpTransact(entities interface{}, orderingKey string, workspace string, ap
 		message.CorrelationId = uuid.NewString()
 	}
 
-	client := http.DefaultClient
-
-	logger.Debugf("Transacting entities with correlation id %s:\n%s", message.CorrelationId, string(bs))
-	j, _ := json.MarshalIndent(message, "", "  ")
-
-	url := "https://api.scout.docker.com/v1/skills/remote/" + workspace
-	if environment.IsStaging() {
-		url = "https://api.scout-stage.docker.com/v1/skills/remote/" + workspace
-	}
-
-	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(j))
+	logger.Debugf("Transacting entities with correlation id %s:\n%s", message.CorrelationId, prettyEDN(bs))
+	j, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
-	httpReq.Header.Set("Authorization", "Bearer "+apikey)
-	httpReq.Header.Set("x-atomist-correlation-id", message.CorrelationId)
-	if orderingKey != "" {
-		httpReq.Header.Set("x-atomist-ordering-key", message.CorrelationId)
+	body, encoding, err := client.compress(j)
+	if err != nil {
+		return err
 	}
 
-	resp, err := client.Do(httpReq)
+	url := client.Options().ScoutURL + "/v1/skills/remote/" + workspace
+
+	resp, attempts, err := doWithRetry(ctx, client.HTTPClient(), options.retryPolicy, logger, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := client.NewRequest(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+apikey)
+		if encoding != "" {
+			httpReq.Header.Set("Content-Encoding", encoding)
+		}
+		httpReq.Header.Set("x-atomist-correlation-id", message.CorrelationId)
+		if orderingKey != "" {
+			httpReq.Header.Set("x-atomist-ordering-key", message.CorrelationId)
+		}
+		return httpReq, nil
+	})
+	options.telemetry.orDefault().recordTransaction(ctx, []attribute.KeyValue{workspaceKey.String(workspace)}, len(flattenedEntities), len(j), attempts)
 	if err != nil {
-		return err
+		return fmt.Errorf("error transacting entities after %d attempts: %w", attempts, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 202 {
-		return fmt.Errorf("error transacting entities: %s", resp.Status)
+		return &TransactError{StatusCode: resp.StatusCode, Body: readErrorBody(resp), Attempts: attempts, RetryAfter: retryAfterOf(resp)}
 	}
 
 	return nil
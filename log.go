@@ -19,17 +19,20 @@ package skill
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"regexp"
+	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 
 	"cloud.google.com/go/compute/metadata"
 	"cloud.google.com/go/logging"
-	"github.com/atomist-skills/go-skill/internal"
+	logpb "cloud.google.com/go/logging/apiv2/loggingpb"
 	"github.com/sirupsen/logrus"
-	"olympos.io/encoding/edn"
 )
 
 var (
@@ -86,6 +89,10 @@ type Logger struct {
 	Error  func(msg string)
 	Errorf func(format string, a ...any)
 
+	// LogAttrs writes an entry with structured attributes; loggers without it get
+	// the attributes appended to the message
+	LogAttrs func(level slog.Level, msg string, attrs ...slog.Attr)
+
 	Close func()
 }
 
@@ -111,70 +118,111 @@ func createCommonLabels(event EventIncoming, headers http.Header) map[string]str
 	return labels
 }
 
+// gcpLogSink is the part of *logging.Logger used by the GCP logger
+type gcpLogSink interface {
+	Log(e logging.Entry)
+	Flush() error
+}
+
+var (
+	gcpSinkOnce sync.Once
+	gcpSink     gcpLogSink
+)
+
+// getGcpSink creates the Cloud Logging client once and shares it across requests
+func getGcpSink(ctx context.Context) gcpLogSink {
+	gcpSinkOnce.Do(func() {
+		client, err := logging.NewClient(context.WithoutCancel(ctx), projectID)
+		if err != nil {
+			Log.Warnf("Failed to create Cloud Logging client: %s", err)
+			return
+		}
+		client.OnError = func(err error) {
+			Log.Warnf("Failed to send logs to Cloud Logging: %s", err)
+		}
+		gcpSink = client.Logger("skill_logging")
+	})
+	return gcpSink
+}
+
 func createGcpLogger(ctx context.Context, labels map[string]string) *Logger {
 	if projectID == "" {
 		return nil
 	}
+	sink := getGcpSink(ctx)
+	if sink == nil {
+		return nil
+	}
+	return newGcpLogger(sink, projectID, labels)
+}
 
-	var gcpLogger *logging.Logger
-	var client *logging.Client
-
-	client, _ = logging.NewClient(ctx, projectID)
-	gcpLogger = client.Logger("skill_logging")
+func newGcpLogger(sink gcpLogSink, projectID string, labels map[string]string) *Logger {
+	trace, spanID, sampled := parseTraceContext(labels)
+	if trace != "" {
+		trace = fmt.Sprintf("projects/%s/traces/%s", projectID, trace)
+	}
 
-	if gcpLogger != nil {
-		return nil
+	var doGcpLog = func(msg string, severity logging.Severity, attrs ...slog.Attr) {
+		payload := map[string]interface{}{
+			"message": msg,
+		}
+		for _, a := range attrs {
+			payload[a.Key] = a.Value.Resolve().Any()
+		}
+		sink.Log(logging.Entry{
+			Labels:         labels,
+			Severity:       severity,
+			Payload:        payload,
+			Trace:          trace,
+			SpanID:         spanID,
+			TraceSampled:   sampled,
+			SourceLocation: sourceLocation(),
+		})
 	}
 
-	var doGcpLog = func(msg string, level edn.Keyword) {
-		if gcpLogger != nil {
-			var severity logging.Severity
-			switch level {
-			case internal.Debug:
-				severity = logging.Debug
-			case internal.Info:
-				severity = logging.Info
-			case internal.Warn:
-				severity = logging.Warning
-			case internal.Error:
-				severity = logging.Error
+	// entries below the level of Log are dropped before they are formatted
+	log := func(severity logging.Severity, level logrus.Level) func(string) {
+		return func(msg string) {
+			if Log.IsLevelEnabled(level) {
+				doGcpLog(msg, severity)
+			}
+		}
+	}
+	logf := func(severity logging.Severity, level logrus.Level) func(string, ...any) {
+		return func(format string, a ...any) {
+			if Log.IsLevelEnabled(level) {
+				doGcpLog(fmt.Sprintf(format, a...), severity)
 			}
-			gcpLogger.Log(logging.Entry{
-				Labels:   labels,
-				Severity: severity,
-				Payload:  msg,
-			})
 		}
 	}
 
 	logger := Logger{
-		Debug: func(msg string) {
-			doGcpLog(msg, internal.Debug)
-		},
-		Debugf: func(format string, a ...any) {
-			doGcpLog(fmt.Sprintf(format, a...), internal.Debug)
-		},
-		Info: func(msg string) {
-			doGcpLog(msg, internal.Info)
-		},
-		Infof: func(format string, a ...any) {
-			doGcpLog(fmt.Sprintf(format, a...), internal.Info)
-		},
-		Warn: func(msg string) {
-			doGcpLog(msg, internal.Warn)
-		},
-		Warnf: func(format string, a ...any) {
-			doGcpLog(fmt.Sprintf(format, a...), internal.Warn)
-		},
-		Error: func(msg string) {
-			doGcpLog(msg, internal.Error)
-		},
-		Errorf: func(format string, a ...any) {
-			doGcpLog(fmt.Sprintf(format, a...), internal.Error)
+		Debug:  log(logging.Debug, logrus.DebugLevel),
+		Debugf: logf(logging.Debug, logrus.DebugLevel),
+		Info:   log(logging.Info, logrus.InfoLevel),
+		Infof:  logf(logging.Info, logrus.InfoLevel),
+		Warn:   log(logging.Warning, logrus.WarnLevel),
+		Warnf:  logf(logging.Warning, logrus.WarnLevel),
+		Error:  log(logging.Error, logrus.ErrorLevel),
+		Errorf: logf(logging.Error, logrus.ErrorLevel),
+		LogAttrs: func(level slog.Level, msg string, attrs ...slog.Attr) {
+			severity := logging.Debug
+			switch logrusLevel(level) {
+			case logrus.InfoLevel:
+				severity = logging.Info
+			case logrus.WarnLevel:
+				severity = logging.Warning
+			case logrus.ErrorLevel:
+				severity = logging.Error
+			}
+			if Log.IsLevelEnabled(logrusLevel(level)) {
+				doGcpLog(msg, severity, attrs...)
+			}
 		},
 		Close: func() {
-			if client != nil {
-				_ = client.Close()
+			// the client is shared across requests, so only flush this request's entries
+			if err := sink.Flush(); err != nil {
+				Log.Warnf("Failed to flush logs to Cloud Logging: %s", err)
 			}
 		},
 	}
@@ -182,6 +230,47 @@ func createGcpLogger(ctx context.Context, labels map[string]string) *Logger {
 	return &logger
 }
 
+// parseTraceContext extracts the trace id, span id and sampling decision from
+// the X-Cloud-Trace-Context or W3C traceparent header
+func parseTraceContext(labels map[string]string) (string, string, bool) {
+	// traceparent: 00-<trace-id>-<span-id>-<flags>
+	if parts := strings.Split(labels["trace_parent"], "-"); len(parts) == 4 {
+		return parts[1], parts[2], strings.HasSuffix(parts[3], "1")
+	}
+
+	// X-Cloud-Trace-Context: <trace-id>/<decimal span-id>;o=<sampled>
+	if header := labels["cloud_trace_context"]; header != "" {
+		traceAndSpan, options, _ := strings.Cut(header, ";")
+		trace, span, _ := strings.Cut(traceAndSpan, "/")
+		if spanID, err := strconv.ParseUint(span, 10, 64); err == nil {
+			span = fmt.Sprintf("%016x", spanID)
+		}
+		return trace, span, options == "o=1"
+	}
+
+	return "", "", false
+}
+
+// sourceLocation finds the first caller outside of this package
+func sourceLocation() *logpb.LogEntrySourceLocation {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var location *logpb.LogEntrySourceLocation
+	for {
+		frame, more := frames.Next()
+		location = &logpb.LogEntrySourceLocation{
+			File:     frame.File,
+			Line:     int64(frame.Line),
+			Function: frame.Function,
+		}
+		inPackage := strings.HasPrefix(frame.Function, "github.com/atomist-skills/go-skill.") && !strings.HasSuffix(frame.File, "_test.go")
+		if !inPackage || !more {
+			return location
+		}
+	}
+}
+
 func createDefaultLogger(ctx context.Context, labels map[string]string) *Logger {
 	localLabels := make(map[string]interface{})
 	for k, v := range labels {
@@ -213,6 +302,16 @@ func createDefaultLogger(ctx context.Context, labels map[string]string) *Logger
 		Errorf: func(format string, a ...any) {
 			Log.WithFields(localLabels).Errorf(format, a...)
 		},
+		LogAttrs: func(level slog.Level, msg string, attrs ...slog.Attr) {
+			fields := make(logrus.Fields, len(localLabels)+len(attrs))
+			for k, v := range localLabels {
+				fields[k] = v
+			}
+			for _, a := range attrs {
+				fields[a.Key] = a.Value.Resolve().Any()
+			}
+			Log.WithFields(fields).Log(logrusLevel(level), msg)
+		},
 		Close: func() {
 		},
 	}
@@ -220,12 +319,15 @@ func createDefaultLogger(ctx context.Context, labels map[string]string) *Logger
 	return &logger
 }
 
-func createLogger(ctx context.Context, event EventIncoming, headers http.Header, loggerCreator CreateLogger) Logger {
+func createLogger(ctx context.Context, event EventIncoming, headers http.Header, loggerCreator CreateLogger, platformLogs *PlatformLogOptions) Logger {
 	labels := createCommonLabels(event, headers)
 
 	loggerCreators := []CreateLogger{
 		createGcpLogger,
 	}
+	if platformLogs != nil {
+		loggerCreators = append(loggerCreators, NewPlatformLogger(event, *platformLogs))
+	}
 
 	if loggerCreator != nil {
 		loggerCreators = append(loggerCreators, loggerCreator)
@@ -283,9 +385,16 @@ func createLogger(ctx context.Context, event EventIncoming, headers http.Header,
 			l.Errorf(format, a...)
 		}
 	}
+	logger.LogAttrs = func(level slog.Level, msg string, attrs ...slog.Attr) {
+		for _, l := range loggers {
+			l.logAttrs(level, msg, attrs)
+		}
+	}
 	logger.Close = func() {
 		for _, l := range loggers {
-			l.Close()
+			if l.Close != nil {
+				l.Close()
+			}
 		}
 	}
 
@@ -0,0 +1,252 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/atomist-skills/go-skill/internal"
+	"github.com/sirupsen/logrus"
+	"olympos.io/encoding/edn"
+)
+
+// PlatformLogOptions configures when a platform logger sends buffered entries
+type PlatformLogOptions struct {
+	// MaxEntries triggers a flush once this many entries are buffered; defaults to 50
+	MaxEntries int
+	// FlushInterval triggers a flush of buffered entries after this time; defaults to 2s
+	FlushInterval time.Duration
+	// CloseTimeout bounds the time closing the Logger waits for outstanding
+	// entries to be sent; defaults to 5s
+	CloseTimeout time.Duration
+	// Client sends the entries; defaults to the default Client
+	Client *Client
+}
+
+// platformLogsFromEnv enables sending logs to the platform with default options
+// if $ATOMIST_LOG_PLATFORM is true
+func platformLogsFromEnv() *PlatformLogOptions {
+	if os.Getenv("ATOMIST_LOG_PLATFORM") == "true" {
+		return &PlatformLogOptions{}
+	}
+	return nil
+}
+
+func (o PlatformLogOptions) orDefault() PlatformLogOptions {
+	if o.MaxEntries <= 0 {
+		o.MaxEntries = 50
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = 2 * time.Second
+	}
+	if o.CloseTimeout <= 0 {
+		o.CloseTimeout = 5 * time.Second
+	}
+	o.Client = o.Client.orDefault()
+	return o
+}
+
+// NewPlatformLogger returns a CreateLogger that ships log entries to the logs url
+// of the event so they show up with the execution in the Atomist UI. Entries are
+// batched and sent in order when the buffer is full, the flush interval passed or
+// the Logger is closed
+func NewPlatformLogger(event EventIncoming, options PlatformLogOptions) CreateLogger {
+	return func(ctx context.Context, labels map[string]string) *Logger {
+		if event.Urls.Logs == "" {
+			return nil
+		}
+
+		// batches still outstanding when the close timeout passes are cancelled
+		ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		p := &platformLogger{
+			ctx:     ctx,
+			cancel:  cancel,
+			event:   event,
+			options: options.orDefault(),
+		}
+		log := func(level edn.Keyword, logrusLevel logrus.Level) func(string) {
+			return func(msg string) {
+				if Log.IsLevelEnabled(logrusLevel) {
+					p.add(level, msg)
+				}
+			}
+		}
+		logf := func(level edn.Keyword, logrusLevel logrus.Level) func(string, ...any) {
+			return func(format string, a ...any) {
+				if Log.IsLevelEnabled(logrusLevel) {
+					p.add(level, fmt.Sprintf(format, a...))
+				}
+			}
+		}
+
+		return &Logger{
+			Debug:  log(internal.Debug, logrus.DebugLevel),
+			Debugf: logf(internal.Debug, logrus.DebugLevel),
+			Info:   log(internal.Info, logrus.InfoLevel),
+			Infof:  logf(internal.Info, logrus.InfoLevel),
+			Warn:   log(internal.Warn, logrus.WarnLevel),
+			Warnf:  logf(internal.Warn, logrus.WarnLevel),
+			Error:  log(internal.Error, logrus.ErrorLevel),
+			Errorf: logf(internal.Error, logrus.ErrorLevel),
+			Close:  p.close,
+		}
+	}
+}
+
+type platformLogger struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	event   EventIncoming
+	options PlatformLogOptions
+
+	mu      sync.Mutex
+	entries []internal.LogEntry
+	timer   *time.Timer
+	closed  bool
+	// batches are sent one after the other by a single worker that runs while
+	// the queue isn't empty
+	queue   [][]internal.LogEntry
+	working bool
+	sending sync.WaitGroup
+}
+
+func (p *platformLogger) add(level edn.Keyword, msg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+
+	p.entries = append(p.entries, internal.LogEntry{
+		Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		Level:     level,
+		Text:      msg,
+	})
+	if len(p.entries) >= p.options.MaxEntries {
+		p.dispatch()
+	} else if p.timer == nil {
+		var timer *time.Timer
+		timer = time.AfterFunc(p.options.FlushInterval, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			// ignore timers stopped by a dispatch while waiting for the lock
+			if p.timer != timer {
+				return
+			}
+			p.dispatch()
+		})
+		p.timer = timer
+	}
+}
+
+// dispatch sends the buffered entries in the background; p.mu has to be held
+func (p *platformLogger) dispatch() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if len(p.entries) == 0 {
+		return
+	}
+
+	p.queue = append(p.queue, p.entries)
+	p.entries = nil
+	if !p.working {
+		p.working = true
+		p.sending.Add(1)
+		go p.work()
+	}
+}
+
+// work sends queued batches in order until the queue is empty
+func (p *platformLogger) work() {
+	defer p.sending.Done()
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 {
+			p.working = false
+			p.mu.Unlock()
+			return
+		}
+		entries := p.queue[0]
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+
+		p.send(entries)
+	}
+}
+
+func (p *platformLogger) send(entries []internal.LogEntry) {
+	if p.ctx.Err() != nil {
+		Log.Warnf("Dropped %d log entries not sent before closing the logger", len(entries))
+		return
+	}
+
+	bs, err := edn.Marshal(internal.LogBody{Logs: entries})
+	if err != nil {
+		Log.Warnf("Failed to marshal log entries: %s", err)
+		return
+	}
+	client := p.options.Client
+	body, encoding, err := client.compress(bs)
+	if err != nil {
+		Log.Warnf("Failed to compress log entries: %s", err)
+		return
+	}
+
+	resp, _, err := doWithRetry(p.ctx, client.HTTPClient(), DefaultRetryPolicy, Logger{Debugf: Log.Debugf}, func(ctx context.Context) (*http.Request, error) {
+		req, err := client.NewRequest(ctx, http.MethodPost, p.event.Urls.Logs, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+p.event.Token)
+		req.Header.Set("Content-Type", "application/edn")
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		return req, nil
+	})
+	if err != nil {
+		// logging through the request logger would end up in this logger again
+		Log.Warnf("Failed to send log entries: %s", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 202 {
+		Log.Warnf("Error sending log entries: %s", resp.Status)
+	}
+}
+
+// close sends all buffered entries and waits for outstanding batches at most
+// for the close timeout
+func (p *platformLogger) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.dispatch()
+	p.mu.Unlock()
+
+	timeout := time.AfterFunc(p.options.CloseTimeout, p.cancel)
+	defer timeout.Stop()
+	p.sending.Wait()
+	p.cancel()
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// With returns a Logger that adds the given key/value pairs or slog.Attr to
+// every entry. Arguments are interpreted like in slog.Logger.With
+func (l Logger) With(args ...any) Logger {
+	attrs := argsToAttrs(args)
+	if len(attrs) == 0 {
+		return l
+	}
+
+	withAttrs := func(a []slog.Attr) []slog.Attr {
+		return append(append(make([]slog.Attr, 0, len(attrs)+len(a)), attrs...), a...)
+	}
+	log := func(level slog.Level) func(string) {
+		return func(msg string) {
+			l.logAttrs(level, msg, attrs)
+		}
+	}
+	logf := func(level slog.Level) func(string, ...any) {
+		return func(format string, a ...any) {
+			l.logAttrs(level, fmt.Sprintf(format, expandFuncs(a, logrusLevel(level))...), attrs)
+		}
+	}
+
+	w := l
+	w.Debug, w.Debugf = log(slog.LevelDebug), logf(slog.LevelDebug)
+	w.Info, w.Infof = log(slog.LevelInfo), logf(slog.LevelInfo)
+	w.Warn, w.Warnf = log(slog.LevelWarn), logf(slog.LevelWarn)
+	w.Error, w.Errorf = log(slog.LevelError), logf(slog.LevelError)
+	w.LogAttrs = func(level slog.Level, msg string, a ...slog.Attr) {
+		l.logAttrs(level, msg, withAttrs(a))
+	}
+	return w
+}
+
+// Slog returns a slog.Logger writing to this Logger
+func (l Logger) Slog() *slog.Logger {
+	return slog.New(NewSlogHandler(l))
+}
+
+// logAttrs writes a structured entry, falling back to appending the attributes
+// to the message for loggers that don't support them
+func (l Logger) logAttrs(level slog.Level, msg string, attrs []slog.Attr) {
+	if l.LogAttrs != nil {
+		l.LogAttrs(level, msg, attrs...)
+		return
+	}
+
+	msg = formatAttrs(msg, attrs)
+	var log func(string)
+	switch {
+	case level < slog.LevelInfo:
+		log = l.Debug
+	case level < slog.LevelWarn:
+		log = l.Info
+	case level < slog.LevelError:
+		log = l.Warn
+	default:
+		log = l.Error
+	}
+	if log != nil {
+		log(msg)
+	}
+}
+
+// NewSlogHandler returns a slog.Handler that writes to logger, e.g. the Logger
+// of a RequestContext, so entries carry the labels of the execution
+func NewSlogHandler(logger Logger) slog.Handler {
+	return &slogHandler{logger: logger}
+}
+
+type slogHandler struct {
+	logger Logger
+	group  string
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return Log.IsLevelEnabled(logrusLevel(level))
+}
+
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, h.qualify(a))
+		return true
+	})
+	h.logger.logAttrs(r.Level, r.Message, attrs)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	args := make([]any, len(attrs))
+	for i, a := range attrs {
+		args[i] = h.qualify(a)
+	}
+	return &slogHandler{logger: h.logger.With(args...), group: h.group}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{logger: h.logger, group: h.group + name + "."}
+}
+
+// qualify prefixes the key of a with the groups of this handler
+func (h *slogHandler) qualify(a slog.Attr) slog.Attr {
+	if h.group != "" {
+		a.Key = h.group + a.Key
+	}
+	return a
+}
+
+// SlogLoggerCreator returns a CreateLogger that writes to handler. The labels of
+// the execution are added as attributes to every entry
+func SlogLoggerCreator(handler slog.Handler) CreateLogger {
+	return func(ctx context.Context, labels map[string]string) *Logger {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		args := make([]any, 0, len(labels))
+		for _, k := range keys {
+			args = append(args, slog.String(k, labels[k]))
+		}
+		l := slog.New(handler).With(args...)
+
+		log := func(level slog.Level) func(string) {
+			return func(msg string) {
+				l.Log(ctx, level, msg)
+			}
+		}
+		logf := func(level slog.Level) func(string, ...any) {
+			return func(format string, a ...any) {
+				if l.Enabled(ctx, level) {
+					l.Log(ctx, level, fmt.Sprintf(format, a...))
+				}
+			}
+		}
+
+		return &Logger{
+			Debug:  log(slog.LevelDebug),
+			Debugf: logf(slog.LevelDebug),
+			Info:   log(slog.LevelInfo),
+			Infof:  logf(slog.LevelInfo),
+			Warn:   log(slog.LevelWarn),
+			Warnf:  logf(slog.LevelWarn),
+			Error:  log(slog.LevelError),
+			Errorf: logf(slog.LevelError),
+			LogAttrs: func(level slog.Level, msg string, attrs ...slog.Attr) {
+				l.LogAttrs(ctx, level, msg, attrs...)
+			},
+			Close: func() {},
+		}
+	}
+}
+
+func argsToAttrs(args []any) []slog.Attr {
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
+
+// formatAttrs appends attrs as key=value pairs to msg
+func formatAttrs(msg string, attrs []slog.Attr) string {
+	if len(attrs) == 0 {
+		return msg
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, a := range attrs {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value.Resolve())
+	}
+	return b.String()
+}
+
+func logrusLevel(level slog.Level) logrus.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return logrus.DebugLevel
+	case level < slog.LevelWarn:
+		return logrus.InfoLevel
+	case level < slog.LevelError:
+		return logrus.WarnLevel
+	default:
+		return logrus.ErrorLevel
+	}
+}
@@ -19,11 +19,17 @@ package skill
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/logging"
 	"github.com/atomist-skills/go-skill/internal"
 	"github.com/sirupsen/logrus"
 
@@ -31,7 +37,9 @@ import (
 )
 
 func TestSuccessfulLogging(t *testing.T) {
+	requests := 0
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
 		authHeader := req.Header.Get("authorization")
 		if authHeader != "Bearer token" {
 			t.Errorf("Authorization header is wrong: %s", authHeader)
@@ -70,8 +78,13 @@ func TestSuccessfulLogging(t *testing.T) {
 			Logs: server.URL,
 		},
 		Token: "token",
-	}, http.Header{}, nil)
+	}, http.Header{}, nil, &PlatformLogOptions{})
 	logger.Infof("This is a %s message", "test")
+	logger.Close()
+
+	if requests != 1 {
+		t.Errorf("Expected log entries to be sent on Close, got %d requests", requests)
+	}
 }
 
 func TestSanitizeEvent(t *testing.T) {
@@ -98,10 +111,192 @@ func TestLoggingWithFunc(t *testing.T) {
 	var buf bytes.Buffer
 	Log.SetOutput(&buf)
 	Log.SetLevel(logrus.DebugLevel)
-	logger := createLogger(context.Background(), EventIncoming{}, http.Header{}, nil)
+	logger := createLogger(context.Background(), EventIncoming{}, http.Header{}, nil, nil)
 	logger.Debugf("This is a %s message", func() interface{} { return "test" })
 
 	if !strings.Contains(buf.String(), "This is a test message") {
 		t.Errorf("Expected message not found")
 	}
 }
+
+func TestPlatformLoggerBatchesEntries(t *testing.T) {
+	var mu sync.Mutex
+	batches := make([]int, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var logEvent internal.LogBody
+		_ = edn.NewDecoder(req.Body).Decode(&logEvent)
+		mu.Lock()
+		batches = append(batches, len(logEvent.Logs))
+		mu.Unlock()
+		rw.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	event := EventIncoming{Token: "token"}
+	event.Urls.Logs = server.URL
+	logger := NewPlatformLogger(event, PlatformLogOptions{MaxEntries: 2, FlushInterval: time.Hour})(context.Background(), nil)
+	for i := 0; i < 5; i++ {
+		logger.Infof("Message %d", i)
+	}
+	logger.Close()
+	logger.Info("Dropped after close")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 3 || batches[0]+batches[1]+batches[2] != 5 {
+		t.Errorf("Expected 5 entries in 3 batches, got %v", batches)
+	}
+}
+
+func TestPlatformLoggerSendsBatchesInOrder(t *testing.T) {
+	var mu sync.Mutex
+	texts := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var logEvent internal.LogBody
+		_ = edn.NewDecoder(req.Body).Decode(&logEvent)
+		mu.Lock()
+		for _, e := range logEvent.Logs {
+			texts = append(texts, e.Text)
+		}
+		mu.Unlock()
+		rw.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	event := EventIncoming{Token: "token"}
+	event.Urls.Logs = server.URL
+	logger := NewPlatformLogger(event, PlatformLogOptions{MaxEntries: 1, FlushInterval: time.Hour})(context.Background(), nil)
+	expected := make([]string, 20)
+	for i := range expected {
+		expected[i] = fmt.Sprintf("Message %d", i)
+		logger.Info(expected[i])
+	}
+	logger.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(texts, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected entries in order, got %v", texts)
+	}
+}
+
+func TestPlatformLoggerCloseTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	event := EventIncoming{Token: "token"}
+	event.Urls.Logs = server.URL
+	logger := NewPlatformLogger(event, PlatformLogOptions{FlushInterval: time.Hour, CloseTimeout: 50 * time.Millisecond})(context.Background(), nil)
+	logger.Info("Never acknowledged")
+
+	start := time.Now()
+	logger.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected close to give up after the timeout, took %s", d)
+	}
+}
+
+type fakeGcpSink struct {
+	entries []logging.Entry
+	flushes int
+}
+
+func (f *fakeGcpSink) Log(e logging.Entry) {
+	f.entries = append(f.entries, e)
+}
+
+func (f *fakeGcpSink) Flush() error {
+	f.flushes++
+	return nil
+}
+
+func TestGcpLogger(t *testing.T) {
+	sink := &fakeGcpSink{}
+	labels := createCommonLabels(EventIncoming{ExecutionId: "1"}, http.Header{
+		"Traceparent": []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+	logger := newGcpLogger(sink, "project", labels)
+	logger.Warnf("Disk %s", "full")
+	logger.Close()
+
+	if len(sink.entries) != 1 || sink.flushes != 1 {
+		t.Fatalf("Expected one entry and one flush, got %d and %d", len(sink.entries), sink.flushes)
+	}
+	e := sink.entries[0]
+	if payload, ok := e.Payload.(map[string]interface{}); !ok || payload["message"] != "Disk full" {
+		t.Errorf("Expected structured payload, got %v", e.Payload)
+	}
+	if e.Severity != logging.Warning || e.Labels["correlation_id"] != "1" {
+		t.Errorf("Expected warning with labels, got %v %v", e.Severity, e.Labels)
+	}
+	if e.Trace != "projects/project/traces/4bf92f3577b34da6a3ce929d0e0e4736" || e.SpanID != "00f067aa0ba902b7" || !e.TraceSampled {
+		t.Errorf("Expected trace correlation, got %s %s %v", e.Trace, e.SpanID, e.TraceSampled)
+	}
+	if e.SourceLocation == nil || !strings.HasSuffix(e.SourceLocation.File, "log_test.go") {
+		t.Errorf("Expected source location of the caller, got %v", e.SourceLocation)
+	}
+}
+
+func TestGcpLoggerHonorsLevel(t *testing.T) {
+	level := Log.GetLevel()
+	defer Log.SetLevel(level)
+	Log.SetLevel(logrus.InfoLevel)
+
+	sink := &fakeGcpSink{}
+	logger := newGcpLogger(sink, "project", map[string]string{})
+	logger.Debugf("Transacting entities: %s", "[...]")
+	logger.LogAttrs(slog.LevelDebug, "Scanned")
+	logger.Info("Scanning")
+
+	if len(sink.entries) != 1 || sink.entries[0].Severity != logging.Info {
+		t.Errorf("Expected only the info entry, got %v", sink.entries)
+	}
+}
+
+func TestParseCloudTraceContext(t *testing.T) {
+	trace, span, sampled := parseTraceContext(map[string]string{"cloud_trace_context": "105445aa7843bc8bf206b12000100000/1;o=1"})
+	if trace != "105445aa7843bc8bf206b12000100000" || span != "0000000000000001" || !sampled {
+		t.Errorf("Unexpected trace context %s %s %v", trace, span, sampled)
+	}
+}
+
+func TestLoggerWithAndSlog(t *testing.T) {
+	var buf bytes.Buffer
+	Log.SetOutput(&buf)
+	Log.SetLevel(logrus.InfoLevel)
+	formatter := Log.Formatter
+	Log.SetFormatter(&logrus.TextFormatter{DisableColors: true, DisableTimestamp: true})
+	defer func() {
+		Log.SetOutput(os.Stdout)
+		Log.SetFormatter(formatter)
+	}()
+
+	logger := createLogger(context.Background(), EventIncoming{ExecutionId: "42"}, http.Header{}, nil, nil)
+	logger.With("digest", "sha256:1").Infof("Scanning %s", "image")
+	logger.Slog().WithGroup("image").Info("Scanned", "packages", 3)
+
+	out := buf.String()
+	for _, expected := range []string{"Scanning image", "digest=\"sha256:1\"", "image.packages=3", "correlation_id=42"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in %s", expected, out)
+		}
+	}
+}
+
+func TestSlogLoggerCreator(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, nil)
+	logger := createLogger(context.Background(), EventIncoming{ExecutionId: "42"}, http.Header{}, SlogLoggerCreator(handler), nil)
+	logger.With("count", 2).Warn("Done")
+
+	if out := buf.String(); !strings.Contains(out, "msg=Done") || !strings.Contains(out, "correlation_id=42") || !strings.Contains(out, "count=2") {
+		t.Errorf("Expected labels and attributes in %s", out)
+	}
+}
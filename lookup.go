@@ -0,0 +1,92 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"reflect"
+	"strings"
+
+	"olympos.io/encoding/edn"
+)
+
+// LookupRef references an existing entity by the value of one of its unique
+// attributes, e.g. [:docker.image/digest "sha256:..."]
+type LookupRef struct {
+	Attribute edn.Keyword
+	Value     interface{}
+}
+
+// NewLookupRef creates a LookupRef for the provided unique attribute and value
+func NewLookupRef(attribute edn.Keyword, value interface{}) LookupRef {
+	return LookupRef{
+		Attribute: attribute,
+		Value:     value,
+	}
+}
+
+// MarshalEDN encodes the lookup ref as a vector; an unset LookupRef is encoded as nil
+func (l LookupRef) MarshalEDN() ([]byte, error) {
+	if l.Attribute == "" {
+		return []byte("nil"), nil
+	}
+	return edn.Marshal([]interface{}{l.Attribute, l.Value})
+}
+
+// collectIdentities records the identity attributes of all entities nested in v
+// by their schema/entity ref
+func collectIdentities(v reflect.Value, identities map[string][]edn.Keyword) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectIdentities(v.Elem(), identities)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectIdentities(v.Index(i), identities)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		if sf, ok := t.FieldByName("Entity"); ok && sf.Type == reflect.TypeOf(Entity{}) {
+			if identity := identityAttributes(t); len(identity) > 0 {
+				identities[v.FieldByIndex(sf.Index).FieldByName("Entity").String()] = identity
+			}
+		}
+		for i := 0; i < t.NumField(); i++ {
+			collectIdentities(v.Field(i), identities)
+		}
+	}
+}
+
+// identityAttributes returns the attributes of all fields tagged with identity:"true".
+// The platform upserts entities by these attributes instead of creating new ones
+func identityAttributes(t reflect.Type) []edn.Keyword {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var identity []edn.Keyword
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Tag.Get("identity") != "true" {
+			continue
+		}
+		if name, _, _ := strings.Cut(sf.Tag.Get("edn"), ","); name != "" && name != "-" {
+			identity = append(identity, edn.Keyword(name))
+		}
+	}
+	return identity
+}
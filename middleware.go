@@ -0,0 +1,45 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+// EventMiddleware wraps an EventHandler to add behaviour before or after its invocation
+type EventMiddleware func(EventHandler) EventHandler
+
+// Chain composes the provided middlewares into one; the first middleware is the outermost
+func Chain(middlewares ...EventMiddleware) EventMiddleware {
+	return func(handler EventHandler) EventHandler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+}
+
+// With returns Handlers that wrap every resolved EventHandler with the provided middlewares
+func (h Handlers) With(middlewares ...EventMiddleware) Handlers {
+	if len(middlewares) == 0 {
+		return h
+	}
+	chain := Chain(middlewares...)
+	return func(name string) (EventHandler, bool) {
+		handler, ok := h(name)
+		if !ok {
+			return handler, ok
+		}
+		return chain(handler), ok
+	}
+}
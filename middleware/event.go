@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/atomist-skills/go-skill"
+)
+
+// NewRecovery recovers from panics in the wrapped handler and turns them into a failed status
+func NewRecovery() skill.EventMiddleware {
+	return func(next skill.EventHandler) skill.EventHandler {
+		return func(ctx context.Context, req skill.RequestContext) (status skill.Status) {
+			defer func() {
+				if err := recover(); err != nil {
+					req.Log.Errorf("Unhandled error occurred: %v", err)
+					req.Log.Debugf("Unhandled error stack trace: %s", string(debug.Stack()))
+					status = skill.NewFailedStatus(fmt.Sprintf("Unhandled error in %s: %v", skill.NameFromEvent(req.Event), err))
+				}
+			}()
+			return next(ctx, req)
+		}
+	}
+}
+
+// NewTiming logs the duration of every invocation of the wrapped handler
+func NewTiming() skill.EventMiddleware {
+	return func(next skill.EventHandler) skill.EventHandler {
+		return func(ctx context.Context, req skill.RequestContext) skill.Status {
+			start := time.Now()
+			status := next(ctx, req)
+			req.Log.Infof("Handler '%s' finished with %s in %d ms", skill.NameFromEvent(req.Event), status.State, time.Since(start).Milliseconds())
+			return status
+		}
+	}
+}
+
+// NewStatusReporting logs the status returned by the wrapped handler at a level
+// matching its state
+func NewStatusReporting() skill.EventMiddleware {
+	return func(next skill.EventHandler) skill.EventHandler {
+		return func(ctx context.Context, req skill.RequestContext) skill.Status {
+			status := next(ctx, req)
+			switch status.State {
+			case skill.Failed:
+				req.Log.Errorf("Handler '%s' failed: %s", skill.NameFromEvent(req.Event), status.Reason)
+			case skill.Completed:
+				req.Log.Infof("Handler '%s' completed: %s", skill.NameFromEvent(req.Event), status.Reason)
+			default:
+				req.Log.Warnf("Handler '%s' returned %s: %s", skill.NameFromEvent(req.Event), status.State, status.Reason)
+			}
+			return status
+		}
+	}
+}
+
+// EntitlementCheck decides whether the workspace of the incoming event may run the handler
+type EntitlementCheck func(ctx context.Context, req skill.RequestContext) (bool, error)
+
+// NewEntitlements only invokes the wrapped handler if check grants the entitlement.
+// A nil check asks the platform using skill.CheckEntitlements. Workspaces without
+// entitlement get a completed status; errors are retryable
+func NewEntitlements(check EntitlementCheck) skill.EventMiddleware {
+	if check == nil {
+		check = skill.CheckEntitlements
+	}
+	return func(next skill.EventHandler) skill.EventHandler {
+		return func(ctx context.Context, req skill.RequestContext) skill.Status {
+			entitled, err := check(ctx, req)
+			if err != nil {
+				req.Log.Warnf("Failed to check entitlements: %s", err)
+				return skill.NewRetryableStatus(fmt.Sprintf("Failed to check entitlements: %s", err))
+			}
+			if !entitled {
+				return skill.NewCompletedStatus(fmt.Sprintf("Workspace %s is not entitled to run %s", req.Event.WorkspaceId, skill.NameFromEvent(req.Event)))
+			}
+			return next(ctx, req)
+		}
+	}
+}
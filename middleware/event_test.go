@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/atomist-skills/go-skill"
+	"github.com/atomist-skills/go-skill/internal/test_util"
+)
+
+func TestRecovery(t *testing.T) {
+	handler := NewRecovery()(func(ctx context.Context, req skill.RequestContext) skill.Status {
+		panic("boom")
+	})
+
+	status := handler(context.Background(), skill.RequestContext{Log: test_util.CreateEmptyLogger()})
+	if status.State != skill.Failed {
+		t.Errorf("Expected failed status, got %s", status.State)
+	}
+}
+
+func TestEntitlements(t *testing.T) {
+	invoked := false
+	next := func(ctx context.Context, req skill.RequestContext) skill.Status {
+		invoked = true
+		return skill.NewCompletedStatus("done")
+	}
+	req := skill.RequestContext{Log: test_util.CreateEmptyLogger()}
+
+	status := NewEntitlements(func(ctx context.Context, req skill.RequestContext) (bool, error) {
+		return false, nil
+	})(next)(context.Background(), req)
+	if invoked || status.State != skill.Completed {
+		t.Errorf("Expected handler not to be invoked")
+	}
+
+	status = NewEntitlements(func(ctx context.Context, req skill.RequestContext) (bool, error) {
+		return false, errors.New("unavailable")
+	})(next)(context.Background(), req)
+	if invoked || status.State != skill.Retryable {
+		t.Errorf("Expected retryable status, got %s", status.State)
+	}
+
+	NewEntitlements(func(ctx context.Context, req skill.RequestContext) (bool, error) {
+		return true, nil
+	})(next)(context.Background(), req)
+	if !invoked {
+		t.Errorf("Expected handler to be invoked")
+	}
+}
+
+func TestPlatformEntitlements(t *testing.T) {
+	entitled := map[string]bool{"T1": true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if entitled[r.URL.Query().Get("workspace")] {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusPaymentRequired)
+	}))
+	defer server.Close()
+
+	handler := NewEntitlements(nil)(func(ctx context.Context, req skill.RequestContext) skill.Status {
+		return skill.NewCompletedStatus("invoked")
+	})
+	for workspace, reason := range map[string]string{
+		"T1": "invoked",
+		"T2": "Workspace T2 is not entitled to run ",
+	} {
+		req := skill.RequestContext{Log: test_util.CreateEmptyLogger()}
+		req.Event.WorkspaceId = workspace
+		req.Event.Token = "token"
+		req.Event.Urls.Entitlements = server.URL + "?workspace=" + workspace
+		if status := handler(context.Background(), req); status.State != skill.Completed || status.Reason != reason {
+			t.Errorf("Unexpected status for %s: %+v", workspace, status)
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) skill.EventMiddleware {
+		return func(next skill.EventHandler) skill.EventHandler {
+			return func(ctx context.Context, req skill.RequestContext) skill.Status {
+				calls = append(calls, name)
+				return next(ctx, req)
+			}
+		}
+	}
+
+	handlers := skill.HandlersFromMap(map[string]skill.EventHandler{
+		"on_push": func(ctx context.Context, req skill.RequestContext) skill.Status {
+			calls = append(calls, "handler")
+			return skill.NewCompletedStatus("done")
+		},
+	}).With(trace("outer"), trace("inner"))
+
+	handler, _ := handlers("on_push")
+	handler(context.Background(), skill.RequestContext{})
+
+	if len(calls) != 3 || calls[0] != "outer" || calls[1] != "inner" || calls[2] != "handler" {
+		t.Errorf("Unexpected invocation order: %v", calls)
+	}
+}
@@ -20,9 +20,9 @@ package skill
 // webhook from the incoming payload
 func NameFromEvent(event EventIncoming) string {
 	switch event.Type {
-	case "subscription":
+	case EventTypeSubscription:
 		return event.Context.Subscription.Name
-	case "webhook":
+	case EventTypeWebhook:
 		name := event.Context.Webhook.Name
 		for _, v := range event.Context.Webhook.Request.Tags {
 			if v.Name == "parameter-name" {
@@ -30,11 +30,11 @@ func NameFromEvent(event EventIncoming) string {
 			}
 		}
 		return name
-	case "query-result":
+	case EventTypeQueryResult:
 		return event.Context.AsyncQueryResult.Name
-	case "event":
+	case EventTypeEvent:
 		return event.Context.Event.Name
-	case "sync-request":
+	case EventTypeSyncRequest:
 		return event.Context.SyncRequest.Name
 	}
 	return ""
@@ -7,3 +7,8 @@ type RetryableExecutionError string
 func (e RetryableExecutionError) Error() string {
 	return fmt.Sprint(string(e))
 }
+
+// Retryable marks the error as retryable for skill.StatusFromError
+func (e RetryableExecutionError) Retryable() bool {
+	return true
+}
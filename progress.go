@@ -0,0 +1,114 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval is the minimum time between two progress updates of
+// an execution
+const DefaultProgressInterval = 2 * time.Second
+
+// Progress reports how far a running execution got
+type Progress struct {
+	Step  int `edn:"step"`
+	Total int `edn:"total"`
+}
+
+func NewProgressStatus(step int, total int, message string) Status {
+	return Status{
+		State:    Running,
+		Reason:   message,
+		Progress: &Progress{Step: step, Total: total},
+	}
+}
+
+// Progress sends a running status reporting step of total steps. Updates within
+// the progress interval of the previous one are dropped, as are updates after
+// the final status of the execution has been sent
+func (r *RequestContext) Progress(ctx context.Context, step int, total int, message string) error {
+	return r.progress.report(ctx, *r, NewProgressStatus(step, total, message))
+}
+
+// progressReporter rate-limits the progress updates of one execution. A nil
+// *progressReporter sends every update
+type progressReporter struct {
+	interval time.Duration
+	// stopped is cancelled once the final status is about to be sent, which
+	// aborts updates still in flight
+	stopped context.Context
+	stop    context.CancelFunc
+	sending sync.WaitGroup
+
+	mu   sync.Mutex
+	last time.Time
+	done bool
+}
+
+func newProgressReporter(interval time.Duration) *progressReporter {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	stopped, stop := context.WithCancel(context.Background())
+	return &progressReporter{interval: interval, stopped: stopped, stop: stop}
+}
+
+func (p *progressReporter) report(ctx context.Context, req RequestContext, status Status) error {
+	if p == nil {
+		return SendStatus(ctx, req, status)
+	}
+
+	p.mu.Lock()
+	if p.done || (!p.last.IsZero() && time.Since(p.last) < p.interval) {
+		p.mu.Unlock()
+		return nil
+	}
+	p.last = time.Now()
+	p.sending.Add(1)
+	p.mu.Unlock()
+	defer p.sending.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(p.stopped, cancel)()
+	return SendStatus(ctx, req, status)
+}
+
+// close stops all further updates and aborts the ones in flight, waiting for
+// them until ctx expires so they can't overtake the final status
+func (p *progressReporter) close(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.done = true
+	p.mu.Unlock()
+	p.stop()
+
+	sent := make(chan struct{})
+	go func() {
+		p.sending.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressIsRateLimited(t *testing.T) {
+	recorder := &statusRecorder{}
+	statusServer := recorder.server()
+	defer statusServer.Close()
+
+	var handled RequestContext
+	server := NewServer(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			handled = req
+			for i := 1; i <= 3; i++ {
+				if err := req.Progress(ctx, i, 3, "Indexing layer"); err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+			}
+			return NewCompletedStatus("done")
+		},
+	}), ServerOptions{ProgressInterval: time.Hour})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testEvent("on_push", statusServer.URL)))
+	server.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	// updates after the final status are dropped
+	if err := handled.Progress(context.Background(), 3, 3, "Indexing layer"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.statuses) != 3 {
+		t.Fatalf("Expected running, progress and completed status, got %v", recorder.statuses)
+	}
+	progress := recorder.statuses[1]
+	if progress.State != Running || progress.Reason != "Indexing layer" || progress.Progress == nil || *progress.Progress != (Progress{Step: 1, Total: 3}) {
+		t.Errorf("Unexpected progress status %+v", progress)
+	}
+	if recorder.statuses[2].State != Completed {
+		t.Errorf("Expected completed status, got %s", recorder.statuses[2].State)
+	}
+}
+
+func TestCloseAbortsProgressInFlight(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	statusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+	}))
+	defer statusServer.Close()
+	defer close(release)
+
+	req := RequestContext{
+		Log:             Logger{Debugf: Log.Debugf},
+		transactOptions: transactOptions{retryPolicy: NoRetryPolicy},
+	}
+	req.Event.Urls.Execution = statusServer.URL
+	reporter := newProgressReporter(time.Hour)
+	reported := make(chan error)
+	go func() {
+		reported <- reporter.report(context.Background(), req, NewProgressStatus(1, 3, "Indexing layer"))
+	}()
+	<-received
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	reporter.close(ctx)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected close to abort the update in flight, took %s", d)
+	}
+	if err := <-reported; err == nil {
+		t.Errorf("Expected the aborted update to fail")
+	}
+}
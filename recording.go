@@ -0,0 +1,169 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/atomist-skills/go-skill/internal"
+	"olympos.io/encoding/edn"
+)
+
+// RecordedTransaction captures a single call to Transact
+type RecordedTransaction struct {
+	Entities    []map[edn.Keyword]edn.RawMessage
+	Ordered     bool
+	OrderingKey string
+	Timestamp   time.Time
+}
+
+// EDN returns the recorded transaction as it would have been sent to the platform
+func (r RecordedTransaction) EDN() ([]byte, error) {
+	return edn.MarshalPPrint(internal.TransactionEntity{
+		Data:        r.Entities,
+		OrderingKey: r.OrderingKey,
+	}, nil)
+}
+
+// RecordingTransactor records all transactions instead of sending them to the platform
+type RecordingTransactor struct {
+	orderingKey  string
+	mu           sync.Mutex
+	transactions []RecordedTransaction
+}
+
+// NewRecordingTransactor creates a RecordingTransactor using orderingKey for ordered transactions
+func NewRecordingTransactor(orderingKey string) *RecordingTransactor {
+	return &RecordingTransactor{
+		orderingKey:  orderingKey,
+		transactions: make([]RecordedTransaction, 0),
+	}
+}
+
+// Transactor returns the Transactor to pass to NewTransaction
+func (r *RecordingTransactor) Transactor() Transactor {
+	return func(entities []interface{}, ordered bool) error {
+		recorded, err := recordTransaction(entities, ordered, r.orderingKey)
+		if err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.transactions = append(r.transactions, recorded)
+		return nil
+	}
+}
+
+// Transactions returns all recorded transactions in the order they were transacted
+func (r *RecordingTransactor) Transactions() []RecordedTransaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedTransaction{}, r.transactions...)
+}
+
+// Entities returns all recorded entities of the given type
+func (r *RecordingTransactor) Entities(entityType edn.Keyword) []map[edn.Keyword]edn.RawMessage {
+	entities := make([]map[edn.Keyword]edn.RawMessage, 0)
+	for _, t := range r.Transactions() {
+		for _, e := range t.Entities {
+			var et edn.Keyword
+			if err := edn.Unmarshal(e["schema/entity-type"], &et); err == nil && et == entityType {
+				entities = append(entities, e)
+			}
+		}
+	}
+	return entities
+}
+
+// ContainsEntity reports whether an entity of the given type with the attribute was
+// transacted. If a value is provided, the attribute has to have that value
+func (r *RecordingTransactor) ContainsEntity(entityType edn.Keyword, attribute edn.Keyword, value ...interface{}) bool {
+	var expected edn.RawMessage
+	if len(value) > 0 {
+		bs, err := edn.Marshal(value[0])
+		if err != nil {
+			return false
+		}
+		expected = bs
+	}
+
+	for _, e := range r.Entities(entityType) {
+		v, ok := e[attribute]
+		if ok && (expected == nil || equalRaw(v, expected)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewDryRunTransactor writes every transaction as EDN to path instead of sending it.
+// If path is an existing directory, every transaction is written to its own file;
+// otherwise transactions are appended to the file at path
+func NewDryRunTransactor(path string, orderingKey string) Transactor {
+	var mu sync.Mutex
+	count := 0
+
+	return func(entities []interface{}, ordered bool) error {
+		recorded, err := recordTransaction(entities, ordered, orderingKey)
+		if err != nil {
+			return err
+		}
+		bs, err := recorded.EDN()
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			name := fmt.Sprintf("transaction-%s-%04d.edn", recorded.Timestamp.Format("20060102T150405"), count)
+			return os.WriteFile(filepath.Join(path, name), append(bs, '\n'), 0o644)
+		}
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.Write(append(bs, '\n'))
+		return err
+	}
+}
+
+func recordTransaction(entities []interface{}, ordered bool, orderingKey string) (RecordedTransaction, error) {
+	if !ordered {
+		orderingKey = ""
+	}
+	transaction, _, err := makeTransaction(entities, orderingKey)
+	if err != nil {
+		return RecordedTransaction{}, err
+	}
+
+	return RecordedTransaction{
+		Entities:    transaction.Data,
+		Ordered:     ordered,
+		OrderingKey: transaction.OrderingKey,
+		Timestamp:   time.Now(),
+	}, nil
+}
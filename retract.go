@@ -0,0 +1,113 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"olympos.io/encoding/edn"
+)
+
+// ManyValues models a scalar attribute of cardinality many
+type ManyValues[T any] struct {
+	Add     []T `edn:"add,omitempty"`
+	Set     []T `edn:"set,omitempty"`
+	Retract []T `edn:"retract,omitempty"`
+}
+
+// AddValues adds values to a cardinality many attribute
+func AddValues[T any](values ...T) ManyValues[T] {
+	return ManyValues[T]{Add: values}
+}
+
+// SetValues replaces all values of a cardinality many attribute
+func SetValues[T any](values ...T) ManyValues[T] {
+	return ManyValues[T]{Set: values}
+}
+
+// RetractValues removes values from a cardinality many attribute
+func RetractValues[T any](values ...T) ManyValues[T] {
+	return ManyValues[T]{Retract: values}
+}
+
+// retractedEntity marks an entity to be retracted with all its attributes
+type retractedEntity struct {
+	entity interface{}
+}
+
+func (r retractedEntity) MarshalEDN() ([]byte, error) {
+	bs, err := edn.Marshal(r.entity)
+	if err != nil {
+		return nil, err
+	}
+
+	var e map[edn.Keyword]edn.RawMessage
+	if err := edn.Unmarshal(bs, &e); err != nil {
+		return nil, err
+	}
+	e["schema/retract"] = edn.RawMessage("true")
+
+	return edn.Marshal(e)
+}
+
+// attributeRetraction retracts a single value of an attribute of an entity
+type attributeRetraction struct {
+	ref        string
+	entityType string
+	attribute  edn.Keyword
+	value      interface{}
+}
+
+func (r attributeRetraction) MarshalEDN() ([]byte, error) {
+	e := map[edn.Keyword]interface{}{
+		"schema/entity": r.ref,
+		r.attribute:     ManyValues[interface{}]{Retract: []interface{}{r.value}},
+	}
+	if r.entityType != "" {
+		e["schema/entity-type"] = edn.Keyword(r.entityType)
+	}
+
+	return edn.Marshal(e)
+}
+
+// Retract marks the provided entities to be retracted. The entities are identified
+// by their schema/entity-type and identity attributes
+func (t *transaction) Retract(entities ...interface{}) Transaction {
+	for _, e := range entities {
+		t.entities = append(t.entities, retractedEntity{entity: makeEntity(e)})
+	}
+	return t
+}
+
+// RetractAttribute retracts value from the attribute of the entity identified by ref
+func (t *transaction) RetractAttribute(ref string, attribute edn.Keyword, value interface{}) Transaction {
+	t.entities = append(t.entities, attributeRetraction{
+		ref:        ref,
+		entityType: t.entityType(ref),
+		attribute:  attribute,
+		value:      value,
+	})
+	return t
+}
+
+// entityType returns the type of the entity with the given ref in this transaction
+func (t *transaction) entityType(ref string) string {
+	for _, e := range t.entities {
+		if entity, ok := entityOf(e); ok && entity.Entity == ref {
+			return string(entity.EntityType)
+		}
+	}
+	return ""
+}
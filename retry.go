@@ -0,0 +1,190 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed requests to the platform are retried. Requests
+// are retried on network errors and on 429 and 5xx responses
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; it doubles on every retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used when no RetryPolicy is configured
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+}
+
+// NoRetryPolicy sends every request exactly once
+var NoRetryPolicy = RetryPolicy{
+	MaxAttempts: 1,
+}
+
+func (p RetryPolicy) orDefault() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		return DefaultRetryPolicy
+	}
+	return p
+}
+
+// backoff returns the delay before the given retry using exponential backoff with jitter
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 0; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// equal jitter keeps at least half of the delay
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// allows reports whether waiting for delay before the next attempt fits MaxBackoff
+// and the deadline of ctx
+func (p RetryPolicy) allows(ctx context.Context, delay time.Duration) bool {
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false
+	}
+	return true
+}
+
+// TransactError reports a transaction the platform did not accept
+type TransactError struct {
+	StatusCode int
+	Body       string
+	Attempts   int
+	// RetryAfter is the delay the platform asked for before sending it again
+	RetryAfter time.Duration
+}
+
+func (e *TransactError) Error() string {
+	return fmt.Sprintf("error transacting entities after %d attempts: %d %s", e.Attempts, e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the transaction might succeed when sent again later
+func (e *TransactError) Retryable() bool {
+	return isRetryableStatusCode(e.StatusCode)
+}
+
+func (e *TransactError) retryAfter() time.Duration {
+	return e.RetryAfter
+}
+
+func isRetryableStatusCode(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// doWithRetry sends requests created by newRequest until one succeeds, fails with
+// a non-retryable status or the policy gives up. A Retry-After header replaces the
+// backoff; if it asks for more than MaxBackoff or the deadline of ctx allows, the
+// response is returned right away for the caller to report the delay. The body of the returned response
+// has to be closed by the caller
+func doWithRetry(ctx context.Context, client *http.Client, policy RetryPolicy, logger Logger, newRequest func(ctx context.Context) (*http.Request, error)) (*http.Response, int, error) {
+	policy = policy.orDefault()
+
+	var attempt int
+	for {
+		attempt++
+		req, err := newRequest(ctx)
+		if err != nil {
+			return nil, attempt, err
+		}
+
+		resp, err := client.Do(req)
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			return resp, attempt, err
+		}
+
+		var delay time.Duration
+		if err != nil {
+			logger.Debugf("Request to %s failed: %s", req.URL, err)
+			delay = policy.backoff(attempt - 1)
+		} else if isRetryableStatusCode(resp.StatusCode) {
+			logger.Debugf("Request to %s failed: %s", req.URL, resp.Status)
+			delay = policy.backoff(attempt - 1)
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if !policy.allows(ctx, retryAfter) {
+					return resp, attempt, nil
+				}
+				delay = retryAfter
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			return resp, attempt, nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// parseRetryAfter parses both forms of the Retry-After header
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryAfterOf returns the delay requested by the Retry-After header of resp
+func retryAfterOf(resp *http.Response) time.Duration {
+	d, _ := parseRetryAfter(resp.Header.Get("Retry-After"))
+	return d
+}
+
+// readErrorBody reads a bounded part of a response body for error reporting
+func readErrorBody(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return string(body)
+}
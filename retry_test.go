@@ -0,0 +1,131 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+}
+
+func transactionEvent(url string) EventIncoming {
+	event := EventIncoming{
+		Type:  "subscription",
+		Token: "token",
+	}
+	event.Urls.Transactions = url
+	return event
+}
+
+func TestTransactRetriesServerErrors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts < 3 {
+			rw.Header().Set("Retry-After", "0")
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(202)
+	}))
+	defer server.Close()
+
+	logger := *createDefaultLogger(context.Background(), map[string]string{})
+	err := newTransactionFromRequest(context.Background(), transactionEvent(server.URL), logger, transactOptions{retryPolicy: testRetryPolicy}).
+		AddEntities(Bar{Name: "1"}).
+		Transact()
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestLongRetryAfterIsReported(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		rw.Header().Set("Retry-After", "3600")
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	logger := *createDefaultLogger(context.Background(), map[string]string{})
+	err := newTransactionFromRequest(context.Background(), transactionEvent(server.URL), logger, transactOptions{retryPolicy: testRetryPolicy}).
+		AddEntities(Bar{Name: "1"}).
+		Transact()
+
+	var transactErr *TransactError
+	if !errors.As(err, &transactErr) || transactErr.RetryAfter != time.Hour {
+		t.Fatalf("Expected TransactError asking to retry after an hour, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected no early retries, got %d attempts", attempts)
+	}
+	if status := StatusFromError(fmt.Errorf("indexing: %w", err)); status.State != Retryable || status.RetryAfter != time.Hour {
+		t.Errorf("Expected retryable status after an hour, got %+v", status)
+	}
+}
+
+func TestTransactReturnsTransactError(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte("invalid entity"))
+	}))
+	defer server.Close()
+
+	logger := *createDefaultLogger(context.Background(), map[string]string{})
+	err := newTransactionFromRequest(context.Background(), transactionEvent(server.URL), logger, transactOptions{retryPolicy: testRetryPolicy}).
+		AddEntities(Bar{Name: "1"}).
+		Transact()
+
+	var transactErr *TransactError
+	if !errors.As(err, &transactErr) {
+		t.Fatalf("Expected TransactError, got %v", err)
+	}
+	if transactErr.StatusCode != http.StatusBadRequest || transactErr.Body != "invalid entity" || transactErr.Retryable() {
+		t.Errorf("Unexpected error: %v", transactErr)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected no retries for client errors, got %d attempts", attempts)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("2"); !ok || d != 2*time.Second {
+		t.Errorf("Expected 2s, got %s", d)
+	}
+	if _, ok := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)); !ok {
+		t.Errorf("Expected HTTP date to be parsed")
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Errorf("Expected invalid value to be ignored")
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"olympos.io/encoding/edn"
+)
+
+// Types of incoming events
+const (
+	EventTypeSubscription edn.Keyword = "subscription"
+	EventTypeWebhook      edn.Keyword = "webhook"
+	EventTypeSyncRequest  edn.Keyword = "sync-request"
+	EventTypeQueryResult  edn.Keyword = "query-result"
+	EventTypeEvent        edn.Keyword = "event"
+)
+
+// AnyEventType registers a route for events of every type
+const AnyEventType edn.Keyword = ""
+
+// Router dispatches events to handlers registered per event type by exact
+// name, name prefix or regular expression. Exact names take precedence over
+// the longest matching prefix, which takes precedence over regular expressions
+// in the order they were registered. Events matching no route are passed to the
+// default handler or fail listing all registered routes
+type Router struct {
+	routes   []route
+	fallback EventHandler
+}
+
+type route struct {
+	eventType edn.Keyword
+	name      string
+	prefix    string
+	pattern   *regexp.Regexp
+	handler   EventHandler
+}
+
+// NewRouter creates an empty Router
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for events of eventType with the given name
+func (r *Router) Handle(eventType edn.Keyword, name string, handler EventHandler) *Router {
+	r.routes = append(r.routes, route{eventType: eventType, name: name, handler: handler})
+	return r
+}
+
+// HandlePrefix registers handler for events of eventType whose name starts with prefix
+func (r *Router) HandlePrefix(eventType edn.Keyword, prefix string, handler EventHandler) *Router {
+	r.routes = append(r.routes, route{eventType: eventType, prefix: prefix, handler: handler})
+	return r
+}
+
+// HandleRegexp registers handler for events of eventType whose name matches pattern
+func (r *Router) HandleRegexp(eventType edn.Keyword, pattern *regexp.Regexp, handler EventHandler) *Router {
+	r.routes = append(r.routes, route{eventType: eventType, pattern: pattern, handler: handler})
+	return r
+}
+
+// Default registers handler for all events matching no other route
+func (r *Router) Default(handler EventHandler) *Router {
+	r.fallback = handler
+	return r
+}
+
+// Handlers returns Handlers resolving names matched by a route of any event type
+// to the Router, which picks the handler once the type of the event is known.
+// Without a default handler, names matching no route are not resolved at all,
+// so their events fail right away listing all registered routes
+func (r *Router) Handlers() Handlers {
+	return func(name string) (EventHandler, bool) {
+		if r.fallback != nil {
+			return r.handle, true
+		}
+		for _, rt := range r.routes {
+			if rt.matches(name) {
+				return r.handle, true
+			}
+		}
+		return r.notFound, false
+	}
+}
+
+func (r *Router) handle(ctx context.Context, req RequestContext) Status {
+	name := NameFromEvent(req.Event)
+	if handler, ok := r.match(req.Event.Type, name); ok {
+		return handler(ctx, req)
+	}
+	return r.notFound(ctx, req)
+}
+
+// notFound fails an event matching no route, listing all registered routes
+func (r *Router) notFound(_ context.Context, req RequestContext) Status {
+	registered := make([]string, len(r.routes))
+	for i, rt := range r.routes {
+		registered[i] = rt.String()
+	}
+	if len(registered) == 0 {
+		registered = append(registered, "none")
+	}
+	return NewFailedStatus(fmt.Sprintf("No handler for %s '%s'; registered: %s", string(req.Event.Type), NameFromEvent(req.Event), strings.Join(registered, ", "))).
+		WithError("no-handler", ConfigurationError)
+}
+
+// match finds the handler for an event of eventType with the given name
+func (r *Router) match(eventType edn.Keyword, name string) (EventHandler, bool) {
+	var prefixed *route
+	var matched *route
+	for i := range r.routes {
+		rt := &r.routes[i]
+		if rt.eventType != AnyEventType && rt.eventType != eventType {
+			continue
+		}
+		if !rt.matches(name) {
+			continue
+		}
+		switch {
+		case rt.pattern != nil:
+			if matched == nil {
+				matched = rt
+			}
+		case rt.prefix != "":
+			if prefixed == nil || len(rt.prefix) > len(prefixed.prefix) {
+				prefixed = rt
+			}
+		default:
+			return rt.handler, true
+		}
+	}
+
+	switch {
+	case prefixed != nil:
+		return prefixed.handler, true
+	case matched != nil:
+		return matched.handler, true
+	case r.fallback != nil:
+		return r.fallback, true
+	}
+	return nil, false
+}
+
+// matches reports whether the route matches name ignoring the event type
+func (rt route) matches(name string) bool {
+	switch {
+	case rt.pattern != nil:
+		return rt.pattern.MatchString(name)
+	case rt.prefix != "":
+		return strings.HasPrefix(name, rt.prefix)
+	default:
+		return rt.name == name
+	}
+}
+
+func (rt route) String() string {
+	eventType := string(rt.eventType)
+	if rt.eventType == AnyEventType {
+		eventType = "any"
+	}
+	switch {
+	case rt.pattern != nil:
+		return fmt.Sprintf("%s /%s/", eventType, rt.pattern)
+	case rt.prefix != "":
+		return fmt.Sprintf("%s '%s*'", eventType, rt.prefix)
+	default:
+		return fmt.Sprintf("%s '%s'", eventType, rt.name)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"olympos.io/encoding/edn"
+)
+
+func routedEvent(eventType edn.Keyword, name string) RequestContext {
+	var req RequestContext
+	req.Event.Type = eventType
+	req.Event.Context.Subscription.Name = name
+	req.Event.Context.Webhook.Name = name
+	req.Event.Context.SyncRequest.Name = name
+	return req
+}
+
+func TestRouter(t *testing.T) {
+	reply := func(reason string) EventHandler {
+		return func(ctx context.Context, req RequestContext) Status {
+			return NewCompletedStatus(reason)
+		}
+	}
+
+	router := NewRouter().
+		Handle(EventTypeSubscription, "on_push", reply("subscription")).
+		Handle(EventTypeWebhook, "on_push", reply("webhook")).
+		HandlePrefix(EventTypeSubscription, "on_", reply("prefix")).
+		HandlePrefix(EventTypeSubscription, "on_image_", reply("longer prefix")).
+		HandleRegexp(AnyEventType, regexp.MustCompile(`^sync-.*`), reply("regexp"))
+	handlers := router.Handlers()
+
+	for _, tc := range []struct {
+		eventType edn.Keyword
+		name      string
+		reason    string
+	}{
+		{EventTypeSubscription, "on_push", "subscription"},
+		{EventTypeWebhook, "on_push", "webhook"},
+		{EventTypeSubscription, "on_tag", "prefix"},
+		{EventTypeSubscription, "on_image_pushed", "longer prefix"},
+		{EventTypeSyncRequest, "sync-policies", "regexp"},
+	} {
+		handler, ok := handlers(tc.name)
+		if !ok {
+			t.Fatalf("Expected a handler for %s", tc.name)
+		}
+		if status := handler(context.Background(), routedEvent(tc.eventType, tc.name)); status.Reason != tc.reason {
+			t.Errorf("Expected %s %s to be handled by %s, got %s", string(tc.eventType), tc.name, tc.reason, status.Reason)
+		}
+	}
+
+	handler, _ := handlers("on_tag")
+	status := handler(context.Background(), routedEvent(EventTypeWebhook, "on_tag"))
+	expected := "No handler for webhook 'on_tag'; registered: subscription 'on_push', webhook 'on_push', subscription 'on_*', subscription 'on_image_*', any /^sync-.*/"
+	if status.State != Failed || status.Reason != expected || status.ErrorCategory != ConfigurationError {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	router.Default(reply("default"))
+	if status := handler(context.Background(), routedEvent(EventTypeWebhook, "on_tag")); status.Reason != "default" {
+		t.Errorf("Expected default handler, got %s", status.Reason)
+	}
+}
+
+func TestRouterDoesNotResolveUnmatchedNames(t *testing.T) {
+	recorder := &statusRecorder{}
+	statusServer := recorder.server()
+	defer statusServer.Close()
+
+	invoked := false
+	handlers := NewRouter().
+		Handle(EventTypeSubscription, "on_push", func(ctx context.Context, req RequestContext) Status {
+			return NewCompletedStatus("done")
+		}).
+		Handlers().
+		With(func(next EventHandler) EventHandler {
+			invoked = true
+			return next
+		})
+	if _, ok := handlers("on_tag"); ok {
+		t.Errorf("Expected on_tag not to be resolved")
+	}
+
+	handler := createHttpHandler(handlers, handlerOptions{})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testEvent("on_tag", statusServer.URL))))
+
+	if states := recorder.states(); len(states) != 1 || states[0] != Failed {
+		t.Fatalf("Expected only a failed status, got %v", states)
+	}
+	if reason := recorder.statuses[0].Reason; !strings.Contains(reason, "registered: subscription 'on_push'") {
+		t.Errorf("Expected the failed status to list the registered routes, got %q", reason)
+	}
+	if invoked {
+		t.Errorf("Expected middlewares not to run for unmatched events")
+	}
+}
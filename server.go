@@ -0,0 +1,352 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout fits within Cloud Run's 10s grace period, including the
+// time to report retryable statuses for handlers that did not finish in time
+const DefaultShutdownTimeout = 8 * time.Second
+
+// ServerOptions configures a Server
+type ServerOptions struct {
+	// Port to listen on; defaults to $PORT or 8080
+	Port string
+	// ShutdownTimeout bounds how long in-flight handlers are drained on shutdown,
+	// including the time needed to report handlers that didn't finish as retryable
+	ShutdownTimeout time.Duration
+	// ExecutionTimeout bounds the context of every handler invocation unless the
+	// skill configuration sets ExecutionTimeoutParameter; defaults to
+	// $ATOMIST_EXECUTION_TIMEOUT
+	ExecutionTimeout time.Duration
+	// ProgressInterval is the minimum time between two progress updates of an
+	// execution; defaults to DefaultProgressInterval
+	ProgressInterval time.Duration
+	// LoggerCreator optionally adds a logger to every request
+	LoggerCreator CreateLogger
+	// PlatformLogs sends the logs of every request to the logs url of its event
+	// so they show up in the Atomist UI; defaults to disabled unless
+	// $ATOMIST_LOG_PLATFORM is true
+	PlatformLogs *PlatformLogOptions
+	// RetryPolicy controls retries of transactions and statuses; defaults to DefaultRetryPolicy
+	RetryPolicy RetryPolicy
+	// ChunkLimits bound the size of a single transaction; defaults to DefaultChunkLimits
+	ChunkLimits ChunkLimits
+	// Client configures all outbound calls to the platform
+	Client ClientOptions
+	// Telemetry configures the OpenTelemetry tracing and metrics
+	Telemetry TelemetryOptions
+	// Validator optionally checks all transactions against the skill's schemata
+	// before they are sent
+	Validator *Validator
+	// Middlewares wrap every EventHandler; the first middleware is the outermost
+	Middlewares []EventMiddleware
+
+	// OnStart is called before the server starts accepting requests
+	OnStart func(ctx context.Context) error
+	// OnShutdown is called after in-flight handlers have been drained or aborted
+	OnShutdown func(ctx context.Context) error
+}
+
+// Server serves incoming skill events and drains in-flight handlers on shutdown
+type Server struct {
+	handlers   Handlers
+	options    ServerOptions
+	executions *executions
+	client     *Client
+	telemetry  *telemetry
+	httpServer *http.Server
+	cancel     context.CancelFunc
+}
+
+// NewServer creates a new Server for the provided Handlers
+func NewServer(handlers Handlers, options ServerOptions) *Server {
+	if options.Port == "" {
+		options.Port = os.Getenv("PORT")
+	}
+	if options.Port == "" {
+		options.Port = "8080"
+	}
+	if options.ShutdownTimeout <= 0 {
+		options.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if options.ExecutionTimeout <= 0 {
+		options.ExecutionTimeout = executionTimeoutFromEnv()
+	}
+	if options.PlatformLogs == nil {
+		options.PlatformLogs = platformLogsFromEnv()
+	}
+
+	if options.Client.Propagator == nil {
+		options.Client.Propagator = options.Telemetry.Propagator
+	}
+
+	baseCtx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		handlers:   handlers.With(options.Middlewares...),
+		options:    options,
+		executions: newExecutions(),
+		client:     NewClient(options.Client),
+		telemetry:  newTelemetry(options.Telemetry),
+		cancel:     cancel,
+	}
+	if s.options.PlatformLogs != nil && s.options.PlatformLogs.Client == nil {
+		platformLogs := *s.options.PlatformLogs
+		platformLogs.Client = s.client
+		s.options.PlatformLogs = &platformLogs
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s.Handler())
+	s.httpServer = &http.Server{
+		Addr:    ":" + options.Port,
+		Handler: mux,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
+	}
+
+	return s
+}
+
+// Handler returns the http.Handler dispatching events to the registered Handlers
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(createHttpHandler(s.handlers, handlerOptions{
+		loggerCreator:    s.options.LoggerCreator,
+		platformLogs:     s.options.PlatformLogs,
+		executionTimeout: s.options.ExecutionTimeout,
+		progressInterval: s.options.ProgressInterval,
+		transactOptions: transactOptions{
+			retryPolicy: s.options.RetryPolicy,
+			chunkLimits: s.options.ChunkLimits,
+			validator:   s.options.Validator,
+			client:      s.client,
+			telemetry:   s.telemetry,
+		},
+		executions: s.executions,
+	}))
+}
+
+// Start runs the server until SIGINT or SIGTERM is received
+func (s *Server) Start() error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return s.Run(ctx)
+}
+
+// Run runs the server until the provided context is cancelled and then shuts it down
+func (s *Server) Run(ctx context.Context) error {
+	if s.options.OnStart != nil {
+		if err := s.options.OnStart(ctx); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.serve(ctx, listener)
+}
+
+func (s *Server) serve(ctx context.Context, listener net.Listener) error {
+	errs := make(chan error, 1)
+	go func() {
+		Log.Debugf("Listening on %s", listener.Addr())
+		errs <- s.httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.options.ShutdownTimeout)
+	defer cancel()
+
+	return s.Shutdown(shutdownCtx)
+}
+
+// abortBudget is the part of the shutdown deadline reserved for sending the
+// retryable statuses of handlers that didn't finish in time
+const abortBudget = 2 * time.Second
+
+// Shutdown stops accepting new requests and waits for in-flight handlers until
+// shortly before the provided context expires. The remaining time is used to send
+// a retryable status for handlers still running, whose context is then cancelled,
+// and to wait for them to return so their loggers are closed
+func (s *Server) Shutdown(ctx context.Context) error {
+	Log.Info("Shutting down skill...")
+
+	drainCtx, abortCtx := ctx, ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		budget := min(abortBudget, time.Until(deadline)/2)
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithDeadline(ctx, deadline.Add(-budget))
+		defer cancel()
+	} else {
+		var cancel context.CancelFunc
+		abortCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), abortBudget)
+		defer cancel()
+	}
+
+	err := s.httpServer.Shutdown(drainCtx)
+	if err != nil {
+		Log.Warnf("Aborting %d in-flight handlers: %s", s.executions.len(), err)
+		s.executions.abort(abortCtx, NewRetryableStatus("Skill instance shut down before handler completed"))
+		err = nil
+	}
+	s.cancel()
+	if n := s.executions.wait(abortCtx); n > 0 {
+		Log.Warnf("%d aborted handlers did not return before shutdown", n)
+	}
+
+	if s.options.OnShutdown != nil {
+		err = s.options.OnShutdown(ctx)
+	}
+
+	return err
+}
+
+// execution tracks a single in-flight invocation of an EventHandler
+type execution struct {
+	req     RequestContext
+	started time.Time
+	// done is closed once the handler returned and the logger is closed
+	done chan struct{}
+
+	statusOnce sync.Once
+	closeOnce  sync.Once
+}
+
+// complete sends the final status for this execution; only the first call sends
+func (e *execution) complete(ctx context.Context, status Status) error {
+	var err error
+	e.statusOnce.Do(func() {
+		e.req.progress.close(ctx)
+		e.req.transactOptions.telemetry.orDefault().recordExecution(ctx, e.req.Event, time.Since(e.started), status)
+		err = SendStatus(ctx, e.req, status)
+	})
+	return err
+}
+
+// close closes the request logger once
+func (e *execution) close() {
+	e.closeOnce.Do(func() {
+		if e.req.Log.Close != nil {
+			e.req.Log.Close()
+		}
+	})
+}
+
+// executions records all in-flight executions of a Server. A nil *executions is
+// valid and only tracks the individual execution
+type executions struct {
+	mu     sync.Mutex
+	active map[*execution]struct{}
+}
+
+func newExecutions() *executions {
+	return &executions{
+		active: make(map[*execution]struct{}),
+	}
+}
+
+func (e *executions) start(req RequestContext) *execution {
+	x := &execution{req: req, started: time.Now(), done: make(chan struct{})}
+	if e != nil {
+		e.mu.Lock()
+		e.active[x] = struct{}{}
+		e.mu.Unlock()
+	}
+	return x
+}
+
+func (e *executions) finish(x *execution) {
+	x.close()
+	if e != nil {
+		e.mu.Lock()
+		delete(e.active, x)
+		e.mu.Unlock()
+	}
+	close(x.done)
+}
+
+// wait waits for all in-flight executions to finish until ctx expires and
+// returns the number of executions still running
+func (e *executions) wait(ctx context.Context) int {
+	e.mu.Lock()
+	active := make([]*execution, 0, len(e.active))
+	for x := range e.active {
+		active = append(active, x)
+	}
+	e.mu.Unlock()
+
+	for i, x := range active {
+		select {
+		case <-x.done:
+		case <-ctx.Done():
+			return len(active) - i
+		}
+	}
+	return 0
+}
+
+func (e *executions) len() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.active)
+}
+
+// abort sends the given status for all in-flight executions in parallel until
+// ctx expires. Their loggers are closed once their handlers return
+func (e *executions) abort(ctx context.Context, status Status) {
+	e.mu.Lock()
+	active := make([]*execution, 0, len(e.active))
+	for x := range e.active {
+		active = append(active, x)
+	}
+	e.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, x := range active {
+		wg.Add(1)
+		go func(x *execution) {
+			defer wg.Done()
+			if err := x.complete(ctx, status); err != nil {
+				x.req.Log.Warnf("Failed to send status: %s", err)
+			}
+		}(x)
+	}
+	wg.Wait()
+}
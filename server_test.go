@@ -0,0 +1,244 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/atomist-skills/go-skill/internal"
+	"olympos.io/encoding/edn"
+)
+
+type statusRecorder struct {
+	mu       sync.Mutex
+	statuses []Status
+}
+
+func (r *statusRecorder) server() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Status Status `edn:"status"`
+		}
+		_ = edn.NewDecoder(req.Body).Decode(&body)
+		r.mu.Lock()
+		r.statuses = append(r.statuses, body.Status)
+		r.mu.Unlock()
+		rw.WriteHeader(202)
+	}))
+}
+
+func (r *statusRecorder) states() []edn.Keyword {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := make([]edn.Keyword, len(r.statuses))
+	for i, s := range r.statuses {
+		states[i] = s.State
+	}
+	return states
+}
+
+func testEvent(name string, executionUrl string) string {
+	return fmt.Sprintf(`{:execution-id "1" :type :subscription :workspace-id "T1"
+ :skill {:namespace "atomist" :name "test" :version "0.1.0"}
+ :context {:subscription {:name "%s" :result []}}
+ :urls {:execution "%s"}
+ :token "token"}`, name, executionUrl)
+}
+
+func TestServerDrainsInFlightHandlers(t *testing.T) {
+	recorder := &statusRecorder{}
+	statusServer := recorder.server()
+	defer statusServer.Close()
+
+	started := make(chan struct{})
+	shutdown := false
+	server := NewServer(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return NewCompletedStatus("done")
+		},
+	}), ServerOptions{
+		OnShutdown: func(ctx context.Context) error {
+			shutdown = true
+			return nil
+		},
+	})
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.serve(ctx, listener) }()
+
+	go http.Post("http://"+listener.Addr().String(), "application/edn", strings.NewReader(testEvent("on_push", statusServer.URL)))
+	<-started
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if !shutdown {
+		t.Errorf("Expected OnShutdown to be called")
+	}
+	if states := recorder.states(); len(states) != 2 || states[1] != Completed {
+		t.Errorf("Expected completed status, got %v", states)
+	}
+}
+
+func TestServerAbortsHandlersAfterDeadline(t *testing.T) {
+	recorder := &statusRecorder{}
+	statusServer := recorder.server()
+	defer statusServer.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	closed := make(chan struct{})
+	server := NewServer(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			close(started)
+			<-release
+			return NewCompletedStatus("done")
+		},
+	}), ServerOptions{
+		ShutdownTimeout: 50 * time.Millisecond,
+		LoggerCreator: func(ctx context.Context, labels map[string]string) *Logger {
+			logger := *createDefaultLogger(ctx, labels)
+			logger.Close = func() {
+				close(closed)
+			}
+			return &logger
+		},
+	})
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.serve(ctx, listener) }()
+
+	go http.Post("http://"+listener.Addr().String(), "application/edn", strings.NewReader(testEvent("on_push", statusServer.URL)))
+	<-started
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if states := recorder.states(); len(states) != 2 || states[1] != Retryable {
+		t.Errorf("Expected retryable status, got %v", states)
+	}
+	select {
+	case <-closed:
+		t.Errorf("Expected logger of the running handler to stay open")
+	default:
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Errorf("Expected logger to be closed once the handler returned")
+	}
+	if states := recorder.states(); len(states) != 2 {
+		t.Errorf("Expected no status after the retryable one, got %v", states)
+	}
+}
+
+func TestServerWaitsForAbortedHandlers(t *testing.T) {
+	recorder := &statusRecorder{}
+	statusServer := recorder.server()
+	defer statusServer.Close()
+
+	started := make(chan struct{})
+	var closed atomic.Bool
+	server := NewServer(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			close(started)
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			return NewCompletedStatus("cancelled")
+		},
+	}), ServerOptions{
+		ShutdownTimeout: time.Second,
+		LoggerCreator: func(ctx context.Context, labels map[string]string) *Logger {
+			logger := *createDefaultLogger(ctx, labels)
+			logger.Close = func() {
+				closed.Store(true)
+			}
+			return &logger
+		},
+	})
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.serve(ctx, listener) }()
+
+	go http.Post("http://"+listener.Addr().String(), "application/edn", strings.NewReader(testEvent("on_push", statusServer.URL)))
+	<-started
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if !closed.Load() {
+		t.Errorf("Expected the logger of the aborted handler to be closed before shutdown returned")
+	}
+}
+
+func TestServerSendsPlatformLogs(t *testing.T) {
+	recorder := &statusRecorder{}
+	statusServer := recorder.server()
+	defer statusServer.Close()
+
+	var mu sync.Mutex
+	var texts []string
+	logServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var body internal.LogBody
+		_ = edn.NewDecoder(req.Body).Decode(&body)
+		mu.Lock()
+		for _, e := range body.Logs {
+			texts = append(texts, e.Text)
+		}
+		mu.Unlock()
+		rw.WriteHeader(202)
+	}))
+	defer logServer.Close()
+
+	server := NewServer(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			req.Log.Info("Handling push")
+			return NewCompletedStatus("done")
+		},
+	}), ServerOptions{PlatformLogs: &PlatformLogOptions{FlushInterval: time.Hour}})
+
+	event := strings.Replace(testEvent("on_push", statusServer.URL), ":urls {", fmt.Sprintf(":urls {:logs %q ", logServer.URL), 1)
+	server.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(event)))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(strings.Join(texts, "\n"), "Handling push") {
+		t.Errorf("Expected handler logs to be sent to the platform, got %v", texts)
+	}
+}
@@ -19,11 +19,14 @@ package skill
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"time"
 
 	"github.com/atomist-skills/go-skill/internal"
+	"github.com/google/uuid"
 
 	"olympos.io/encoding/edn"
 )
@@ -44,55 +47,243 @@ func NewFailedStatus(reason string) Status {
 
 func NewRetryableStatus(reason string) Status {
 	return Status{
-		State:  retryable,
-		Reason: reason,
+		State:         Retryable,
+		Reason:        reason,
+		ErrorCategory: TransientError,
 	}
 }
 
 func NewRunningStatus(reason string) Status {
 	return Status{
-		State:  running,
+		State:  Running,
 		Reason: reason,
 	}
 }
 
+// ErrorCategory classifies why an execution failed or has to be retried
+type ErrorCategory edn.Keyword
+
+const (
+	// TransientError is expected to go away when the execution is retried
+	TransientError ErrorCategory = "transient"
+	// RateLimitError is returned when a service asked to back off
+	RateLimitError ErrorCategory = "rate-limit"
+	// ConfigurationError requires the skill configuration to be changed
+	ConfigurationError ErrorCategory = "configuration"
+	// PermissionError requires additional permissions to be granted
+	PermissionError ErrorCategory = "permission"
+	// InvalidInputError is caused by data the skill can't process
+	InvalidInputError ErrorCategory = "invalid-input"
+	// InternalError is a bug in the skill
+	InternalError ErrorCategory = "internal"
+)
+
+func (c ErrorCategory) MarshalEDN() ([]byte, error) {
+	return edn.Marshal(edn.Keyword(c))
+}
+
+func (c *ErrorCategory) UnmarshalEDN(bs []byte) error {
+	var k edn.Keyword
+	if err := edn.Unmarshal(bs, &k); err != nil {
+		return err
+	}
+	*c = ErrorCategory(k)
+	return nil
+}
+
+// WithRetryAfter returns s asking the platform to retry not before d
+func (s Status) WithRetryAfter(d time.Duration) Status {
+	s.RetryAfter = d
+	return s
+}
+
+// WithError returns s with the provided error code and category
+func (s Status) WithError(code string, category ErrorCategory) Status {
+	s.ErrorCode = code
+	s.ErrorCategory = category
+	return s
+}
+
+// WithDetail returns s with the key set to value in its details
+func (s Status) WithDetail(key string, value interface{}) Status {
+	details := make(map[string]interface{}, len(s.Details)+1)
+	for k, v := range s.Details {
+		details[k] = v
+	}
+	details[key] = value
+	s.Details = details
+	return s
+}
+
+// plainStatus has the fields but not the methods of Status
+type plainStatus Status
+
+type statusEDN struct {
+	plainStatus
+	RetryAfterMs int64 `edn:"retry-after-ms,omitempty"`
+}
+
+func (s Status) MarshalEDN() ([]byte, error) {
+	return edn.Marshal(statusEDN{
+		plainStatus:  plainStatus(s),
+		RetryAfterMs: s.RetryAfter.Milliseconds(),
+	})
+}
+
+func (s *Status) UnmarshalEDN(bs []byte) error {
+	var v statusEDN
+	if err := edn.Unmarshal(bs, &v); err != nil {
+		return err
+	}
+	*s = Status(v.plainStatus)
+	s.RetryAfter = time.Duration(v.RetryAfterMs) * time.Millisecond
+	return nil
+}
+
+// StatusError annotates an error with the structured fields of the Status it
+// is mapped onto by StatusFromError
+type StatusError struct {
+	Err        error
+	Code       string
+	Category   ErrorCategory
+	RetryAfter time.Duration
+	Details    map[string]interface{}
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the execution might succeed when retried
+func (e *StatusError) Retryable() bool {
+	return e.RetryAfter > 0 || e.Category == TransientError || e.Category == RateLimitError || isRetryable(e.Err)
+}
+
+// StatusFromError maps err onto a Status. Errors with a Retryable() bool method
+// reporting true, e.g. types.RetryableExecutionError or TransactError, result in
+// a retryable status and all others in a failed one. TransactError and
+// SendStatusError provide the delay the platform asked for; a StatusError in the
+// chain provides code, category, retry hint and details
+func StatusFromError(err error) Status {
+	status := NewFailedStatus(err.Error())
+	if isRetryable(err) {
+		status = NewRetryableStatus(err.Error())
+	}
+
+	var delayed interface{ retryAfter() time.Duration }
+	if errors.As(err, &delayed) {
+		status.RetryAfter = delayed.retryAfter()
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		status.ErrorCode = statusErr.Code
+		if statusErr.Category != "" {
+			status.ErrorCategory = statusErr.Category
+		}
+		if statusErr.RetryAfter > 0 {
+			status.RetryAfter = statusErr.RetryAfter
+		}
+		status.Details = statusErr.Details
+	}
+	return status
+}
+
+func isRetryable(err error) bool {
+	var r interface{ Retryable() bool }
+	return errors.As(err, &r) && r.Retryable()
+}
+
+// SendStatus sends status for the execution of req. Requests are retried as
+// configured by ServerOptions.RetryPolicy
 func SendStatus(ctx context.Context, req RequestContext, status Status) error {
-	return SendEventStatus(ctx, req.Event, req.Log, status)
+	return sendEventStatus(ctx, req.Event, req.Log, req.transactOptions, status)
 }
 
+// SendEventStatus sends status for the execution of event. Requests are retried
+// with the DefaultRetryPolicy
 func SendEventStatus(ctx context.Context, event EventIncoming, logger Logger, status Status) error {
+	return sendEventStatus(ctx, event, logger, transactOptions{}, status)
+}
+
+// SendStatusError reports a status the platform did not accept
+type SendStatusError struct {
+	StatusCode int
+	Body       string
+	Attempts   int
+	// RetryAfter is the delay the platform asked for before sending it again
+	RetryAfter time.Duration
+}
+
+func (e *SendStatusError) retryAfter() time.Duration {
+	return e.RetryAfter
+}
+
+func (e *SendStatusError) Error() string {
+	return fmt.Sprintf("error sending status after %d attempts: %d %s", e.Attempts, e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the status might be accepted when sent again later
+func (e *SendStatusError) Retryable() bool {
+	return isRetryableStatusCode(e.StatusCode)
+}
+
+func sendEventStatus(ctx context.Context, event EventIncoming, logger Logger, options transactOptions, status Status) (err error) {
 	// Don't send the status when evaluating policies locally
 	if os.Getenv("SCOUT_LOCAL_POLICY_EVALUATION") == "true" {
 		return nil
 	}
-	bs, err := edn.MarshalPPrint(internal.StatusBody{
+
+	client := options.client.orDefault()
+	telemetry := options.telemetry.orDefault()
+	attrs := eventAttributes(event)
+	ctx, span := telemetry.start(ctx, "status", append(attrs, stateKey.String(string(status.State))))
+	defer func() { endSpan(span, err) }()
+
+	bs, err := edn.Marshal(internal.StatusBody{
 		Status: status,
-	}, nil)
+	})
 	if err != nil {
 		return err
 	}
 
-	logger.Debugf("Sending status: %s", string(bs))
-	client := http.DefaultClient
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPatch, event.Urls.Execution, bytes.NewBuffer(bs))
-	httpReq.Header.Set("Authorization", "Bearer "+event.Token)
-	httpReq.Header.Set("Content-Type", "application/edn")
+	logger.Debugf("Sending status: %s", prettyEDN(bs))
+	body, encoding, err := client.compress(bs)
 	if err != nil {
 		return err
 	}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		time.Sleep(time.Millisecond * 100)
-		resp, err = client.Do(httpReq)
+
+	// retries carry the same key so the platform applies the status only once
+	idempotencyKey := uuid.NewString()
+	resp, attempts, err := doWithRetry(ctx, client.HTTPClient(), options.retryPolicy, logger, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := client.NewRequest(ctx, http.MethodPatch, event.Urls.Execution, bytes.NewReader(body))
 		if err != nil {
-			return err
+			return nil, err
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+event.Token)
+		httpReq.Header.Set("Content-Type", "application/edn")
+		httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+		if encoding != "" {
+			httpReq.Header.Set("Content-Encoding", encoding)
 		}
+		return httpReq, nil
+	})
+	telemetry.recordRetries(ctx, attrs, "status", attempts)
+	if err != nil {
+		telemetry.recordStatus(ctx, attrs, status, "error")
+		return fmt.Errorf("error sending status after %d attempts: %w", attempts, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 202 {
-		Log.Warnf("Error sending status: %s", resp.Status)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		telemetry.recordStatus(ctx, attrs, status, "rejected")
+		return &SendStatusError{StatusCode: resp.StatusCode, Body: readErrorBody(resp), Attempts: attempts, RetryAfter: retryAfterOf(resp)}
 	}
 
+	telemetry.recordStatus(ctx, attrs, status, "sent")
 	return nil
 }
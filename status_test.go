@@ -0,0 +1,141 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/atomist-skills/go-skill/policy/types"
+	"olympos.io/encoding/edn"
+)
+
+func TestStatusDetailsRoundTrip(t *testing.T) {
+	status := NewRetryableStatus("Registry unavailable").
+		WithRetryAfter(90*time.Second).
+		WithError("registry-unavailable", RateLimitError).
+		WithDetail("registry", "hub.docker.com")
+
+	bs, err := edn.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`:retry-after-ms 90000`, `:error-code"registry-unavailable"`, `:error-category :rate-limit`, `:details{"registry""hub.docker.com"}`} {
+		if !strings.Contains(string(bs), s) {
+			t.Errorf("Expected %s in %s", s, bs)
+		}
+	}
+
+	var decoded Status
+	if err := edn.Unmarshal(bs, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, status) {
+		t.Errorf("Expected %+v, got %+v", status, decoded)
+	}
+}
+
+func TestStatusFromError(t *testing.T) {
+	status := StatusFromError(fmt.Errorf("evaluating policy: %w", types.RetryableExecutionError("query timed out")))
+	if status.State != Retryable || status.ErrorCategory != TransientError || status.Reason != "evaluating policy: query timed out" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	status = StatusFromError(&TransactError{StatusCode: 503, Attempts: 5})
+	if status.State != Retryable {
+		t.Errorf("Expected retryable status, got %+v", status)
+	}
+
+	status = StatusFromError(fmt.Errorf("fetching image: %w", &StatusError{
+		Err:        errors.New("429 Too Many Requests"),
+		Code:       "registry-rate-limit",
+		Category:   RateLimitError,
+		RetryAfter: time.Minute,
+		Details:    map[string]interface{}{"registry": "ghcr.io"},
+	}))
+	if status.State != Retryable || status.ErrorCode != "registry-rate-limit" || status.ErrorCategory != RateLimitError || status.RetryAfter != time.Minute || status.Details["registry"] != "ghcr.io" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	status = StatusFromError(&StatusError{Err: errors.New("missing parameter"), Code: "missing-parameter", Category: ConfigurationError})
+	if status.State != Failed || status.ErrorCategory != ConfigurationError {
+		t.Errorf("Expected failed status, got %+v", status)
+	}
+}
+
+func TestSendStatusRetriesWithIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	req := RequestContext{
+		Log:             Logger{Debugf: Log.Debugf},
+		transactOptions: transactOptions{retryPolicy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}},
+	}
+	req.Event.Urls.Execution = server.URL
+	if err := SendStatus(context.Background(), req, NewCompletedStatus("done")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("Expected a retry with the same idempotency key, got %v", keys)
+	}
+}
+
+func TestRejectedStatusFailsRequest(t *testing.T) {
+	statusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid status"))
+	}))
+	defer statusServer.Close()
+
+	var sendErr error
+	server := NewServer(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			sendErr = SendStatus(ctx, req, NewRunningStatus("still running"))
+			return NewCompletedStatus("done")
+		},
+	}), ServerOptions{})
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testEvent("on_push", statusServer.URL))))
+
+	var statusErr *SendStatusError
+	if !errors.As(sendErr, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || statusErr.Body != "invalid status" || statusErr.Attempts != 1 {
+		t.Errorf("Expected rejected status, got %v", sendErr)
+	}
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the failed status to be reported to the platform, got %d", rec.Code)
+	}
+}
@@ -4,17 +4,36 @@ import (
 	"olympos.io/encoding/edn"
 )
 
+// GetResultInMapForm returns the subscription result as a list of maps. Decoding
+// errors are ignored; use TryGetResultInMapForm to handle them
 func (e *EventContextSubscription) GetResultInMapForm() []map[edn.Keyword]edn.RawMessage {
-	return decode[[]map[edn.Keyword]edn.RawMessage](e.Result)
+	result, _ := e.TryGetResultInMapForm()
+	return result
 }
 
+// GetResultInListForm returns the subscription result as a list of tuples. Decoding
+// errors are ignored; use TryGetResultInListForm to handle them
 func (e *EventContextSubscription) GetResultInListForm() [][]edn.RawMessage {
+	result, _ := e.TryGetResultInListForm()
+	return result
+}
+
+// TryGetResultInMapForm returns the subscription result as a list of maps
+func (e *EventContextSubscription) TryGetResultInMapForm() ([]map[edn.Keyword]edn.RawMessage, error) {
+	return decode[[]map[edn.Keyword]edn.RawMessage](e.Result)
+}
+
+// TryGetResultInListForm returns the subscription result as a list of tuples
+func (e *EventContextSubscription) TryGetResultInListForm() ([][]edn.RawMessage, error) {
 	return decode[[][]edn.RawMessage](e.Result)
 }
 
-func decode[P interface{}](event edn.RawMessage) P {
-	ednboby, _ := edn.Marshal(event)
+func decode[P interface{}](event edn.RawMessage) (P, error) {
 	var decoded P
-	edn.Unmarshal(ednboby, &decoded)
-	return decoded
+	ednbody, err := edn.Marshal(event)
+	if err != nil {
+		return decoded, err
+	}
+	err = edn.Unmarshal(ednbody, &decoded)
+	return decoded, err
 }
@@ -0,0 +1,183 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/atomist-skills/go-skill"
+
+const (
+	skillKey        = attribute.Key("atomist.skill")
+	subscriptionKey = attribute.Key("atomist.subscription")
+	workspaceKey    = attribute.Key("atomist.workspace")
+	stateKey        = attribute.Key("atomist.status.state")
+	outcomeKey      = attribute.Key("atomist.status.outcome")
+	requestTypeKey  = attribute.Key("atomist.request")
+)
+
+// TelemetryOptions configures the OpenTelemetry integration. Every provider
+// defaults to the global one of the otel package, which does nothing unless an
+// SDK has been installed
+type TelemetryOptions struct {
+	// TracerProvider creates spans for decoding, handling, statuses and transactions
+	TracerProvider trace.TracerProvider
+	// MeterProvider records handler durations, statuses, transaction sizes and retries
+	MeterProvider metric.MeterProvider
+	// Propagator extracts the parent span from incoming requests and injects the
+	// trace context into outbound requests
+	Propagator propagation.TextMapPropagator
+}
+
+func (o TelemetryOptions) orDefault() TelemetryOptions {
+	if o.TracerProvider == nil {
+		o.TracerProvider = otel.GetTracerProvider()
+	}
+	if o.MeterProvider == nil {
+		o.MeterProvider = otel.GetMeterProvider()
+	}
+	if o.Propagator == nil {
+		o.Propagator = otel.GetTextMapPropagator()
+	}
+	return o
+}
+
+// telemetry holds the tracer and instruments of a Server
+type telemetry struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+
+	handlerDuration     metric.Float64Histogram
+	statuses            metric.Int64Counter
+	transactionEntities metric.Int64Histogram
+	transactionSize     metric.Int64Histogram
+	retries             metric.Int64Counter
+}
+
+func newTelemetry(options TelemetryOptions) *telemetry {
+	options = options.orDefault()
+	t := &telemetry{
+		tracer:     options.TracerProvider.Tracer(instrumentationName),
+		propagator: options.Propagator,
+	}
+	if err := t.createInstruments(options.MeterProvider.Meter(instrumentationName)); err != nil {
+		Log.Warnf("Failed to create metric instruments: %s", err)
+		_ = t.createInstruments(noop.NewMeterProvider().Meter(instrumentationName))
+	}
+	return t
+}
+
+func (t *telemetry) createInstruments(meter metric.Meter) error {
+	var err, errs error
+	t.handlerDuration, err = meter.Float64Histogram("atomist.skill.handler.duration",
+		metric.WithDescription("Duration of event handler executions"),
+		metric.WithUnit("s"))
+	errs = errors.Join(errs, err)
+	t.statuses, err = meter.Int64Counter("atomist.skill.statuses",
+		metric.WithDescription("Execution statuses sent to the platform"))
+	errs = errors.Join(errs, err)
+	t.transactionEntities, err = meter.Int64Histogram("atomist.skill.transaction.entities",
+		metric.WithDescription("Number of entities in a transaction"))
+	errs = errors.Join(errs, err)
+	t.transactionSize, err = meter.Int64Histogram("atomist.skill.transaction.size",
+		metric.WithDescription("Size of a transaction before compression"),
+		metric.WithUnit("By"))
+	errs = errors.Join(errs, err)
+	t.retries, err = meter.Int64Counter("atomist.skill.retries",
+		metric.WithDescription("Retried requests to the platform"))
+	return errors.Join(errs, err)
+}
+
+var defaultTelemetry = sync.OnceValue(func() *telemetry {
+	return newTelemetry(TelemetryOptions{})
+})
+
+// orDefault returns t or the telemetry of the global providers if t is nil
+func (t *telemetry) orDefault() *telemetry {
+	if t == nil {
+		return defaultTelemetry()
+	}
+	return t
+}
+
+// eventAttributes identify the skill, subscription and workspace of an event
+func eventAttributes(event EventIncoming) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		skillKey.String(event.Skill.Namespace + "/" + event.Skill.Name),
+		subscriptionKey.String(NameFromEvent(event)),
+		workspaceKey.String(event.WorkspaceId),
+	}
+}
+
+func (t *telemetry) start(ctx context.Context, name string, attrs []attribute.KeyValue, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, append(opts, trace.WithAttributes(attrs...))...)
+}
+
+// endSpan ends span recording err if it isn't nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// recordExecution records the duration and final status of a handler execution
+// on the metrics and the span of ctx
+func (t *telemetry) recordExecution(ctx context.Context, event EventIncoming, duration time.Duration, status Status) {
+	attrs := append(eventAttributes(event), stateKey.String(string(status.State)))
+	t.handlerDuration.Record(ctx, duration.Seconds(), metric.WithAttributes(attrs...))
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(stateKey.String(string(status.State)))
+	if status.State == Failed {
+		span.SetStatus(codes.Error, status.Reason)
+	}
+}
+
+// recordStatus counts a status sent to the platform by its state and whether
+// the platform accepted it
+func (t *telemetry) recordStatus(ctx context.Context, attrs []attribute.KeyValue, status Status, outcome string) {
+	attrs = append(attrs, stateKey.String(string(status.State)), outcomeKey.String(outcome))
+	t.statuses.Add(ctx, 1, metric.WithAttributes(attrs...))
+}
+
+// recordTransaction records the size of a transaction chunk and how often it
+// had to be retried
+func (t *telemetry) recordTransaction(ctx context.Context, attrs []attribute.KeyValue, entities int, size int, attempts int) {
+	t.transactionEntities.Record(ctx, int64(entities), metric.WithAttributes(attrs...))
+	t.transactionSize.Record(ctx, int64(size), metric.WithAttributes(attrs...))
+	t.recordRetries(ctx, attrs, "transact", attempts)
+}
+
+func (t *telemetry) recordRetries(ctx context.Context, attrs []attribute.KeyValue, request string, attempts int) {
+	if attempts > 1 {
+		t.retries.Add(ctx, int64(attempts-1), metric.WithAttributes(append(attrs, requestTypeKey.String(request))...))
+	}
+}
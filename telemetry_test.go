@@ -0,0 +1,138 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTelemetryTracesAndMeasuresExecutions(t *testing.T) {
+	var mu sync.Mutex
+	traceparents := make(map[string]string)
+	platform := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents[r.Method] = r.Header.Get("traceparent")
+		mu.Unlock()
+		w.WriteHeader(202)
+	}))
+	defer platform.Close()
+
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	server := NewServer(HandlersFromMap(map[string]EventHandler{
+		"on_push": func(ctx context.Context, req RequestContext) Status {
+			if err := req.NewTransaction().AddEntities(MakeEntity(Bar{Name: "bar"})).Transact(); err != nil {
+				return NewFailedStatus(err.Error())
+			}
+			return NewCompletedStatus("done")
+		},
+	}), ServerOptions{
+		Telemetry: TelemetryOptions{
+			TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+			MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+			Propagator:     propagation.TraceContext{},
+		},
+	})
+
+	event := fmt.Sprintf(`{:execution-id "1" :type :subscription :workspace-id "T1"
+ :skill {:namespace "atomist" :name "test" :version "0.1.0"}
+ :context {:subscription {:name "on_push" :result []}}
+ :urls {:execution "%[1]s" :transactions "%[1]s"}
+ :token "token"}`, platform.URL)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(event))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	server.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	names := make(map[string]bool)
+	for _, s := range spans.Ended() {
+		names[s.Name()] = true
+		if s.SpanContext().TraceID().String() != traceID {
+			t.Errorf("span %s not part of trace %s: %s", s.Name(), traceID, s.SpanContext().TraceID())
+		}
+	}
+	for _, name := range []string{"decode", "handle on_push", "status", "transact"} {
+		if !names[name] {
+			t.Errorf("missing span %s in %v", name, names)
+		}
+	}
+	if len(traceparents) != 2 {
+		t.Errorf("expected status and transaction requests, got %v", traceparents)
+	}
+	for method, traceparent := range traceparents {
+		if !strings.HasPrefix(traceparent, "00-"+traceID+"-") {
+			t.Errorf("%s request carries wrong trace context %q", method, traceparent)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	duration, ok := metrics["atomist.skill.handler.duration"].(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 1 {
+		t.Fatalf("unexpected handler duration %v", metrics["atomist.skill.handler.duration"])
+	}
+	attrs := duration.DataPoints[0].Attributes
+	for k, v := range map[attribute.Key]string{
+		"atomist.skill":        "atomist/test",
+		"atomist.subscription": "on_push",
+		"atomist.workspace":    "T1",
+		"atomist.status.state": "completed",
+	} {
+		if value, _ := attrs.Value(k); value.AsString() != v {
+			t.Errorf("expected %s=%s, got %s", k, v, value.AsString())
+		}
+	}
+
+	statuses, ok := metrics["atomist.skill.statuses"].(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("unexpected statuses %v", metrics["atomist.skill.statuses"])
+	}
+	var sent int64
+	for _, dp := range statuses.DataPoints {
+		sent += dp.Value
+	}
+	if sent != 2 {
+		t.Errorf("expected the running and completed status, got %d", sent)
+	}
+
+	entities, ok := metrics["atomist.skill.transaction.entities"].(metricdata.Histogram[int64])
+	if !ok || len(entities.DataPoints) != 1 || entities.DataPoints[0].Sum != 1 {
+		t.Errorf("unexpected transaction entities %v", metrics["atomist.skill.transaction.entities"])
+	}
+}
@@ -17,6 +17,7 @@
 package test
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -37,6 +38,7 @@ type SimulateOptions struct {
 	TxData        string
 	WorkspaceId   string
 	Token         string
+	Client        skill.ClientOptions
 }
 
 type SimulateResult struct {
@@ -95,8 +97,11 @@ func Simulate(options SimulateOptions, t *testing.T) SimulateResult {
 }
 `, options.Skill.Id, options.Skill.Namespace, options.Skill.Name, options.Skill.Version, schemata, subscriptionName[0:len(subscriptionName)-4], string(subscription), string(configuration), string(txData))
 
-	client := http.DefaultClient
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("https://api.atomist.com/datalog/team/%s/simulate", options.WorkspaceId), strings.NewReader(payload))
+	client := skill.NewClient(options.Client)
+	req, err := client.NewRequest(context.Background(), http.MethodPost, fmt.Sprintf("%s/datalog/team/%s/simulate", client.Options().AtomistURL, options.WorkspaceId), strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("Failed to create simulation request: %s", err)
+	}
 	req.Header.Set("Authorization", "Bearer "+options.Token)
 	req.Header.Set("Content-Type", "application/edn")
 	resp, err := client.Do(req)
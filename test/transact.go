@@ -0,0 +1,41 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"testing"
+
+	"github.com/atomist-skills/go-skill"
+	"olympos.io/encoding/edn"
+)
+
+// AssertContainsEntity fails the test if no entity of entityType with the attribute
+// (and optionally the value) was recorded
+func AssertContainsEntity(t *testing.T, recorder *skill.RecordingTransactor, entityType edn.Keyword, attribute edn.Keyword, value ...interface{}) {
+	t.Helper()
+	if !recorder.ContainsEntity(entityType, attribute, value...) {
+		t.Errorf("Expected transaction to contain entity %s with attribute %s %v", entityType, attribute, value)
+	}
+}
+
+// AssertTransactionCount fails the test if not exactly count transactions were recorded
+func AssertTransactionCount(t *testing.T, recorder *skill.RecordingTransactor, count int) {
+	t.Helper()
+	if transactions := recorder.Transactions(); len(transactions) != count {
+		t.Errorf("Expected %d transactions, got %d", count, len(transactions))
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/atomist-skills/go-skill/internal"
@@ -45,12 +46,18 @@ type ManyRef struct {
 	Retract []string `edn:"retract,omitempty"`
 }
 
-// Transaction collects entities
+// Transaction collects entities. Entities added more than once with the same
+// schema/entity id are merged into the first occurrence when transacting; for
+// conflicting attributes the first value wins and the others are dropped with
+// a warning. Use Conflicts to detect them before calling Transact
 type Transaction interface {
 	Ordered() Transaction
 	AddEntities(entities ...interface{}) Transaction
+	Retract(entities ...interface{}) Transaction
+	RetractAttribute(ref string, attribute edn.Keyword, value interface{}) Transaction
 	EntityRefs(entityType string) []string
 	EntityRef(entityType string) string
+	Conflicts() ([]EntityConflict, error)
 	Transact() error
 }
 
@@ -69,7 +76,7 @@ func NewTransaction(ctx context.Context, transactor Transactor) Transaction {
 
 func NewStringTransactor(stringTransactionFunc func(string)) Transactor {
 	return func(entities []interface{}, ordered bool) error {
-		transactions, err := makeTransaction(entities, "")
+		transactions, _, err := makeTransaction(entities, "")
 		if err != nil {
 			return err
 		}
@@ -82,7 +89,13 @@ func NewStringTransactor(stringTransactionFunc func(string)) Transactor {
 }
 
 func NewHttpTransactor(teamId string, token string, orderingKey string, correlationId string, logger Logger) Transactor {
-	sender := createHttpMessageSender(teamId, token, correlationId, logger)
+	return NewHttpTransactorWithClient(teamId, token, orderingKey, correlationId, logger, nil)
+}
+
+// NewHttpTransactorWithClient creates a Transactor like NewHttpTransactor that
+// sends its requests with client; a nil client uses the default one
+func NewHttpTransactorWithClient(teamId string, token string, orderingKey string, correlationId string, logger Logger, client *Client) Transactor {
+	sender := createHttpMessageSender(context.Background(), teamId, token, correlationId, logger, transactOptions{client: client})
 
 	return func(entities []interface{}, ordered bool) error {
 		if ordered {
@@ -151,6 +164,11 @@ func (t *transaction) EntityRef(entityType string) string {
 	return EntityRef(t.entities, entityType)
 }
 
+// Conflicts reports entities added more than once with conflicting attributes
+func (t *transaction) Conflicts() ([]EntityConflict, error) {
+	return EntityConflicts(t.entities)
+}
+
 // newTransaction creates a new Transaction to record entities
 func newTransaction(ctx context.Context, transactor Transactor) Transaction {
 	return &transaction{
@@ -174,6 +192,26 @@ func EntityRefs(entities []interface{}, entityType string) []string {
 	return entityRefs
 }
 
+// entityOf returns the Entity embedded in the provided entity struct
+func entityOf(e interface{}) (Entity, bool) {
+	v := reflect.ValueOf(e)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return Entity{}, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return Entity{}, false
+	}
+	f := v.FieldByName("Entity")
+	if !f.IsValid() {
+		return Entity{}, false
+	}
+	entity, ok := f.Interface().(Entity)
+	return entity, ok
+}
+
 // EntityRef finds one entity by given entityType and returns its identity
 func EntityRef(entities []interface{}, entityType string) string {
 	if entityRefs := EntityRefs(entities, entityType); len(entityRefs) > 0 {
@@ -190,15 +228,35 @@ type messageSender struct {
 	TransactOrdered TransactOrdered
 }
 
-func createMessageSender(ctx context.Context, event EventIncoming, logger Logger) messageSender {
+// transactOptions configures how transactions are sent to the platform
+type transactOptions struct {
+	retryPolicy RetryPolicy
+	chunkLimits ChunkLimits
+	validator   *Validator
+	client      *Client
+	telemetry   *telemetry
+}
+
+// validate wraps transactor to validate entities if a validator is configured
+func (o transactOptions) validate(transactor Transactor) Transactor {
+	if o.validator == nil {
+		return transactor
+	}
+	return NewValidatingTransactor(o.validator, transactor)
+}
+
+func createMessageSender(ctx context.Context, event EventIncoming, logger Logger, options transactOptions) messageSender {
 	messageSender := messageSender{}
 
-	messageSender.TransactOrdered = func(entities interface{}, orderingKey string) error {
+	messageSender.TransactOrdered = func(entities interface{}, orderingKey string) (err error) {
 		// Don't transact when evaluating policies locally
 		if os.Getenv("SCOUT_LOCAL_POLICY_EVALUATION") == "true" {
 			return nil
 		}
 
+		ctx, span := options.telemetry.orDefault().start(ctx, "transact", eventAttributes(event))
+		defer func() { endSpan(span, err) }()
+
 		var entityArray []interface{}
 		rt := reflect.TypeOf(entities)
 		switch rt.Kind() {
@@ -209,32 +267,29 @@ func createMessageSender(ctx context.Context, event EventIncoming, logger Logger
 			entityArray = []any{entities}
 		}
 
-		transactions, err := makeTransaction(entityArray, orderingKey)
-
-		bs, err := edn.MarshalPPrint(internal.TransactionEntityBody{
-			Transactions: []internal.TransactionEntity{*transactions}}, nil)
+		transactions, conflicts, err := makeTransaction(entityArray, orderingKey)
 		if err != nil {
 			return err
 		}
-
-		client := http.DefaultClient
-
-		logger.Debugf("Transacting entities: %s", string(bs))
-
-		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, event.Urls.Transactions, bytes.NewBuffer(bs))
-		if err != nil {
-			return err
-		}
-		httpReq.Header.Set("Authorization", "Bearer "+event.Token)
-		httpReq.Header.Set("Content-Type", "application/edn")
-		resp, err := client.Do(httpReq)
-		if err != nil {
-			return err
+		for _, c := range conflicts {
+			logger.Warnf("Ignoring conflicting value for %s", c)
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != 202 {
-			Log.Warnf("Error transacting entities: %s", resp.Status)
+		chunks := chunkTransaction(transactions, options.chunkLimits)
+		for i, chunk := range chunks {
+			bs, err := edn.Marshal(internal.TransactionEntityBody{
+				Transactions: []internal.TransactionEntity{chunk}})
+			if err != nil {
+				return err
+			}
+
+			if len(chunks) > 1 {
+				logger.Debugf("Transacting chunk %d/%d", i+1, len(chunks))
+			}
+			err = sendTransaction(ctx, event, logger, options, len(chunk.Data), bs)
+			if err != nil {
+				return err
+			}
 		}
 
 		return nil
@@ -247,54 +302,201 @@ func createMessageSender(ctx context.Context, event EventIncoming, logger Logger
 	return messageSender
 }
 
-func makeTransaction(entities []interface{}, orderingKey string) (*internal.TransactionEntity, error) {
+func sendTransaction(ctx context.Context, event EventIncoming, logger Logger, options transactOptions, entities int, bs []byte) error {
+	logger.Debugf("Transacting entities: %s", prettyEDN(bs))
+	client := options.client.orDefault()
+	body, encoding, err := client.compress(bs)
+	if err != nil {
+		return err
+	}
+
+	resp, attempts, err := doWithRetry(ctx, client.HTTPClient(), options.retryPolicy, logger, func(ctx context.Context) (*http.Request, error) {
+		httpReq, err := client.NewRequest(ctx, http.MethodPost, event.Urls.Transactions, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+event.Token)
+		httpReq.Header.Set("Content-Type", "application/edn")
+		if encoding != "" {
+			httpReq.Header.Set("Content-Encoding", encoding)
+		}
+		return httpReq, nil
+	})
+	options.telemetry.orDefault().recordTransaction(ctx, eventAttributes(event), entities, len(bs), attempts)
+	if err != nil {
+		return fmt.Errorf("error transacting entities after %d attempts: %w", attempts, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 202 {
+		return &TransactError{StatusCode: resp.StatusCode, Body: readErrorBody(resp), Attempts: attempts, RetryAfter: retryAfterOf(resp)}
+	}
+
+	return nil
+}
+
+func makeTransaction(entities []interface{}, orderingKey string) (*internal.TransactionEntity, []EntityConflict, error) {
 	body, err := edn.MarshalPPrint(entities, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var e []map[edn.Keyword]edn.RawMessage
 	err = edn.NewDecoder(bytes.NewReader(body)).Decode(&e)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	transactions := internal.TransactionEntity{Data: flattenEntities(e)}
+	data, conflicts := flattenEntities(e)
+	identities := make(map[string][]edn.Keyword)
+	collectIdentities(reflect.ValueOf(entities), identities)
+	for _, entity := range data {
+		if _, ok := entity["schema/identity"]; ok {
+			continue
+		}
+		var ref string
+		if edn.Unmarshal(entity["schema/entity"], &ref) != nil {
+			continue
+		}
+		if identity, ok := identities[ref]; ok {
+			bs, err := edn.Marshal(identity)
+			if err != nil {
+				return nil, nil, err
+			}
+			entity["schema/identity"] = bs
+		}
+	}
+	transactions := internal.TransactionEntity{Data: data}
 	if orderingKey != "" {
 		transactions.OrderingKey = orderingKey
 	}
-	return &transactions, nil
+	return &transactions, conflicts, nil
+}
+
+// EntityConflict describes an entity that was added more than once with different
+// values for the same attribute. The first value is transacted
+type EntityConflict struct {
+	Entity    string
+	Attribute edn.Keyword
+	Values    []edn.RawMessage
+}
+
+func (c EntityConflict) String() string {
+	values := make([]string, len(c.Values))
+	for i, v := range c.Values {
+		values[i] = string(v)
+	}
+	return fmt.Sprintf("%s %s: %s", c.Entity, c.Attribute, strings.Join(values, " vs. "))
 }
 
-func flattenEntities(entities []map[edn.Keyword]edn.RawMessage) []map[edn.Keyword]edn.RawMessage {
+// EntityConflicts finds entities with the same schema/entity identity whose attributes conflict
+func EntityConflicts(entities []interface{}) ([]EntityConflict, error) {
+	_, conflicts, err := makeTransaction(entities, "")
+	return conflicts, err
+}
+
+// flattenEntities flattens nested entities into a list in which referenced entities
+// come before the entities referencing them. Entities are made unique by schema/entity
+// merging the attributes of later occurrences into the first one; conflicting
+// attributes keep the first value and are returned. Retractions are kept apart
+// so they aren't lost when retracting values of an attribute that is also set
+func flattenEntities(entities []map[edn.Keyword]edn.RawMessage) ([]map[edn.Keyword]edn.RawMessage, []EntityConflict) {
 	fEntities := make([]map[edn.Keyword]edn.RawMessage, 0)
 	for _, e := range entities {
 		fEntities = append(fEntities, flattenEntity(e)...)
 	}
 
-	// make entity list unique by schema/entity
-	uEntities := make(map[string]map[edn.Keyword]edn.RawMessage, 0)
+	// make entity list unique by schema/entity preserving the order
+	uEntities := make([]map[edn.Keyword]edn.RawMessage, 0, len(fEntities))
+	seen := make(map[string]map[edn.Keyword]edn.RawMessage, len(fEntities))
+	conflicts := make([]EntityConflict, 0)
 	for _, e := range fEntities {
-		entity := string(e["schema/entity"])
-		if _, ok := uEntities[entity]; !ok {
-			uEntities[entity] = e
+		entity, ok := e["schema/entity"]
+		if !ok || isRetraction(e) {
+			uEntities = append(uEntities, e)
+			continue
 		}
+		if first, ok := seen[string(entity)]; ok {
+			conflicts = append(conflicts, entityConflicts(string(entity), first, e)...)
+			for k, v := range e {
+				if _, ok := first[k]; !ok {
+					first[k] = v
+				}
+			}
+			continue
+		}
+		seen[string(entity)] = e
+		uEntities = append(uEntities, e)
 	}
 
-	// collect the values
-	fEntities = make([]map[edn.Keyword]edn.RawMessage, 0)
-	for _, v := range uEntities {
-		fEntities = append(fEntities, v)
+	return uEntities, conflicts
+}
+
+// isRetraction reports whether entity is retracted as a whole or only retracts
+// values of its attributes
+func isRetraction(entity map[edn.Keyword]edn.RawMessage) bool {
+	if _, ok := entity["schema/retract"]; ok {
+		return true
+	}
+	retracts := false
+	for k, v := range entity {
+		if strings.HasPrefix(string(k), "schema/") {
+			continue
+		}
+		var m map[edn.Keyword]edn.RawMessage
+		if edn.Unmarshal(v, &m) != nil || len(m) != 1 {
+			return false
+		}
+		if _, ok := m["retract"]; !ok {
+			return false
+		}
+		retracts = true
 	}
+	return retracts
+}
 
-	return fEntities
+func entityConflicts(entity string, first map[edn.Keyword]edn.RawMessage, other map[edn.Keyword]edn.RawMessage) []EntityConflict {
+	conflicts := make([]EntityConflict, 0)
+	for _, k := range sortedKeys(other) {
+		v, ok := first[k]
+		if ok && !equalRaw(v, other[k]) {
+			conflicts = append(conflicts, EntityConflict{
+				Entity:    entity,
+				Attribute: k,
+				Values:    []edn.RawMessage{v, other[k]},
+			})
+		}
+	}
+	return conflicts
+}
+
+// equalRaw compares two EDN values ignoring whitespace
+func equalRaw(a edn.RawMessage, b edn.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if edn.Compact(&ca, a) != nil || edn.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
 }
 
+func sortedKeys(entity map[edn.Keyword]edn.RawMessage) []edn.Keyword {
+	keys := make([]edn.Keyword, 0, len(entity))
+	for k := range entity {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// flattenEntity returns all entities nested in entity followed by entity itself with
+// nested entities replaced by references
 func flattenEntity(entity map[edn.Keyword]edn.RawMessage) []map[edn.Keyword]edn.RawMessage {
 	entities := make([]map[edn.Keyword]edn.RawMessage, 0)
-	entities = append(entities, entity)
 
-	for k, v := range entity {
+	for _, k := range sortedKeys(entity) {
+		v := entity[k]
 		if !strings.HasPrefix(k.String(), ":schema/") {
 			// test single entity first
 			var n map[edn.Keyword]edn.RawMessage
@@ -320,7 +522,7 @@ func flattenEntity(entity map[edn.Keyword]edn.RawMessage) []map[edn.Keyword]edn.
 		}
 	}
 
-	return entities
+	return append(entities, entity)
 }
 
 func makeEntity(x interface{}) interface{} {
@@ -18,6 +18,9 @@ package skill
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -82,7 +85,7 @@ func TestMakeTransactionWithNested(t *testing.T) {
 
 	newFoos := makeEntity(foos)
 
-	transactionEntity, err := makeTransaction(newFoos.([]interface{}), "")
+	transactionEntity, _, err := makeTransaction(newFoos.([]interface{}), "")
 	if err != nil {
 		t.Failed()
 	}
@@ -90,3 +93,246 @@ func TestMakeTransactionWithNested(t *testing.T) {
 		t.Errorf("Incorrect number of entities in transaction")
 	}
 }
+
+func TestChunkTransactionOrdersReferencesFirst(t *testing.T) {
+	foo := MakeEntity(Foo{
+		Bars: []Bar{{Name: "1"}, {Name: "2"}, {Name: "3"}},
+	})
+	entities := makeEntity([]any{foo})
+
+	transaction, _, err := makeTransaction(entities.([]interface{}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := chunkTransaction(transaction, ChunkLimits{MaxEntities: 3})
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d", len(chunks))
+	}
+	if chunks[0].OrderingKey == "" || chunks[0].OrderingKey != chunks[1].OrderingKey {
+		t.Errorf("Expected chunks to share an ordering key")
+	}
+	last := chunks[1].Data[len(chunks[1].Data)-1]
+	if string(last["schema/entity-type"]) != ":foo" {
+		t.Errorf("Expected referencing entity to be transacted last, got %s", last["schema/entity-type"])
+	}
+}
+
+func TestFlattenEntitiesPreservesOrder(t *testing.T) {
+	foo := Foo{
+		Entity: Entity{EntityType: "foo", Entity: "$foo"},
+		Bars: []Bar{
+			{Entity: Entity{EntityType: "bar", Entity: "$bar-1"}, Name: "1"},
+			{Entity: Entity{EntityType: "bar", Entity: "$bar-2"}, Name: "2"},
+		},
+		Bar: Bar{Entity: Entity{EntityType: "bar", Entity: "$bar-3"}, Name: "3"},
+	}
+	other := Bar{Entity: Entity{EntityType: "bar", Entity: "$bar-4"}, Name: "4"}
+
+	for i := 0; i < 10; i++ {
+		transaction, _, err := makeTransaction([]interface{}{foo, other}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(transaction.Data))
+		for i, e := range transaction.Data {
+			ids[i] = string(e["schema/entity"])
+		}
+		if strings.Join(ids, " ") != `"$bar-3" "$bar-1" "$bar-2" "$foo" "$bar-4"` {
+			t.Fatalf("Unexpected entity order: %v", ids)
+		}
+	}
+}
+
+func TestEntityConflicts(t *testing.T) {
+	conflicts, err := EntityConflicts([]interface{}{
+		Bar{Entity: Entity{EntityType: "bar", Entity: "$bar"}, Name: "1"},
+		Bar{Entity: Entity{EntityType: "bar", Entity: "$bar"}, Name: "1"},
+		Bar{Entity: Entity{EntityType: "bar", Entity: "$bar"}, Name: "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Attribute != "name" {
+		t.Errorf("Expected one conflict on name, got %v", conflicts)
+	}
+}
+
+func TestTransactKeepsFirstConflictingValue(t *testing.T) {
+	var output string
+	transaction := NewTransaction(context.TODO(), NewStringTransactor(func(entities string) {
+		output = entities
+	}))
+	transaction.AddEntities(
+		Bar{Entity: Entity{EntityType: "bar", Entity: "$bar"}, Name: "first"},
+		Bar{Entity: Entity{EntityType: "bar", Entity: "$bar"}, Name: "last"},
+	)
+	if err := transaction.Transact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output, `"first"`) || strings.Contains(output, `"last"`) || strings.Count(output, `"$bar"`) != 1 {
+		t.Errorf("Expected a single entity with the first value, got %s", output)
+	}
+}
+
+type Tagged struct {
+	Entity `entity-type:"tagged"`
+	Tags   ManyValues[string] `edn:"tags"`
+}
+
+type Named struct {
+	Entity `entity-type:"named"`
+	Id     string `edn:"id"`
+	Name   string `edn:"name,omitempty"`
+}
+
+func TestRetractions(t *testing.T) {
+	var output string
+	transaction := NewTransaction(context.TODO(), NewStringTransactor(func(entities string) {
+		output = entities
+	}))
+
+	named := MakeEntity(Named{Id: "1"}, "$named")
+	transaction.
+		AddEntities(Tagged{Tags: RetractValues("old")}, named).
+		RetractAttribute("$named", "name", "stale").
+		Retract(Bar{Entity: Entity{Entity: "$other"}, Name: "2"})
+	if err := transaction.Transact(); err != nil {
+		t.Fatal(err)
+	}
+
+	compact := strings.Join(strings.Fields(output), " ")
+	for _, expected := range []string{
+		`:tags {:retract ["old"]}`,
+		`:name {:retract ["stale"]}`,
+		`:schema/retract true`,
+	} {
+		if !strings.Contains(compact, expected) {
+			t.Errorf("Expected %s in %s", expected, compact)
+		}
+	}
+}
+
+func TestRetractAttributeAlsoSet(t *testing.T) {
+	var output string
+	transaction := NewTransaction(context.TODO(), NewStringTransactor(func(entities string) {
+		output = entities
+	}))
+
+	transaction.
+		AddEntities(MakeEntity(Tagged{Tags: AddValues("new")}, "$tagged")).
+		RetractAttribute("$tagged", "tags", "stale")
+	if err := transaction.Transact(); err != nil {
+		t.Fatal(err)
+	}
+
+	compact := strings.Join(strings.Fields(output), " ")
+	for _, expected := range []string{
+		`:tags {:add ["new"]}`,
+		`:tags {:retract ["stale"]}`,
+	} {
+		if !strings.Contains(compact, expected) {
+			t.Errorf("Expected %s in %s", expected, compact)
+		}
+	}
+}
+
+type Image struct {
+	Entity     `entity-type:"docker/image"`
+	Digest     string     `edn:"docker.image/digest" identity:"true"`
+	Repository *LookupRef `edn:"docker.image/repository,omitempty"`
+}
+
+func TestLookupRefAndIdentity(t *testing.T) {
+	var output string
+	transaction := NewTransaction(context.TODO(), NewStringTransactor(func(entities string) {
+		output = entities
+	}))
+
+	transaction.AddEntities(Image{
+		Digest:     "sha256:1234",
+		Repository: &LookupRef{Attribute: "docker.repository/host", Value: "hub.docker.com"},
+	}, MakeEntity(Image{Digest: "sha256:5678"}))
+	if err := transaction.Transact(); err != nil {
+		t.Fatal(err)
+	}
+
+	compact := strings.Join(strings.Fields(output), " ")
+	if !strings.Contains(compact, `:docker.image/repository [:docker.repository/host "hub.docker.com"]`) {
+		t.Errorf("Expected lookup ref in %s", compact)
+	}
+	if strings.Count(compact, `:schema/identity [:docker.image/digest]`) != 2 {
+		t.Errorf("Expected identity attributes in %s", compact)
+	}
+}
+
+type Img struct {
+	Entity     `entity-type:"docker/image"`
+	Digest     string    `edn:"docker.image/digest" identity:"true"`
+	Repository LookupRef `edn:"docker.image/repository"`
+}
+
+func TestRetractWithUnsetLookupRef(t *testing.T) {
+	var output string
+	transaction := NewTransaction(context.TODO(), NewStringTransactor(func(entities string) {
+		output = entities
+	}))
+
+	transaction.Retract(Img{Digest: "old"})
+	if err := transaction.Transact(); err != nil {
+		t.Fatal(err)
+	}
+
+	compact := strings.Join(strings.Fields(output), " ")
+	for _, expected := range []string{`:docker.image/repository nil`, `:schema/identity [:docker.image/digest]`, `:schema/retract true`} {
+		if !strings.Contains(compact, expected) {
+			t.Errorf("Expected %s in %s", expected, compact)
+		}
+	}
+	// entities embedding Entity stay comparable
+	if (Img{Digest: "old"}) != (Img{Digest: "old"}) {
+		t.Errorf("Expected equal entities")
+	}
+}
+
+func TestRecordingTransactor(t *testing.T) {
+	recorder := NewRecordingTransactor("key")
+	transaction := NewTransaction(context.TODO(), recorder.Transactor())
+
+	transaction.AddEntities(Bar{Name: "1"}).Transact()
+	transaction.Ordered().Transact()
+
+	transactions := recorder.Transactions()
+	if len(transactions) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(transactions))
+	}
+	if transactions[0].Ordered || transactions[0].OrderingKey != "" {
+		t.Errorf("Expected first transaction to be unordered")
+	}
+	if !transactions[1].Ordered || transactions[1].OrderingKey != "key" {
+		t.Errorf("Expected second transaction to be ordered by key")
+	}
+	if !recorder.ContainsEntity("bar", "name", "1") {
+		t.Errorf("Expected bar with name 1")
+	}
+	if recorder.ContainsEntity("bar", "name", "2") {
+		t.Errorf("Unexpected bar with name 2")
+	}
+}
+
+func TestDryRunTransactor(t *testing.T) {
+	dir := t.TempDir()
+	transaction := NewTransaction(context.TODO(), NewDryRunTransactor(dir, ""))
+	transaction.AddEntities(Bar{Name: "1"}).Transact()
+	transaction.Transact()
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(files))
+	}
+	bs, _ := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if !strings.Contains(string(bs), `:name "1"`) {
+		t.Errorf("Unexpected transaction: %s", string(bs))
+	}
+}
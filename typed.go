@@ -0,0 +1,172 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"olympos.io/encoding/edn"
+)
+
+// TypedEventHandler handles subscription or query results decoded into rows of type T
+type TypedEventHandler[T any] func(ctx context.Context, req RequestContext, rows []T) Status
+
+// HandlerRegistration binds an EventHandler to the name of a subscription or webhook
+type HandlerRegistration struct {
+	Name    string
+	Handler EventHandler
+}
+
+// On registers a TypedEventHandler under the provided name
+func On[T any](name string, handler TypedEventHandler[T]) HandlerRegistration {
+	return HandlerRegistration{
+		Name:    name,
+		Handler: Typed(handler),
+	}
+}
+
+// HandlersFromRegistrations creates Handlers from the provided registrations
+func HandlersFromRegistrations(registrations ...HandlerRegistration) Handlers {
+	handlers := make(map[string]EventHandler, len(registrations))
+	for _, r := range registrations {
+		handlers[r.Name] = r.Handler
+	}
+	return HandlersFromMap(handlers)
+}
+
+// Typed adapts a TypedEventHandler to an EventHandler. Every result tuple is decoded
+// into T; vectors are decoded by position into the exported fields of T, maps by
+// their edn tags. Decoding failures result in a failed status naming the column
+func Typed[T any](handler TypedEventHandler[T]) EventHandler {
+	return func(ctx context.Context, req RequestContext) Status {
+		result := req.Event.Context.Subscription.Result
+		if req.Event.Type == "query-result" {
+			result = req.Event.Context.AsyncQueryResult.Result
+		}
+
+		rows, err := decodeRows[T](result)
+		if err != nil {
+			req.Log.Errorf("Failed to decode result: %s", err)
+			return NewFailedStatus(err.Error()).WithError("decode-result", InvalidInputError)
+		}
+
+		return handler(ctx, req, rows)
+	}
+}
+
+// ColumnDecodeError describes a result column that could not be decoded
+type ColumnDecodeError struct {
+	Row    int
+	Column string
+	Err    error
+}
+
+func (e *ColumnDecodeError) Error() string {
+	return fmt.Sprintf("failed to decode column %s of result row %d: %s", e.Column, e.Row, e.Err)
+}
+
+func (e *ColumnDecodeError) Unwrap() error {
+	return e.Err
+}
+
+func decodeRows[T any](result edn.RawMessage) ([]T, error) {
+	if len(result) == 0 {
+		return []T{}, nil
+	}
+
+	var raw []edn.RawMessage
+	if err := edn.Unmarshal(result, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode result: %w", err)
+	}
+
+	rows := make([]T, len(raw))
+	for i, r := range raw {
+		if err := decodeRow(i, r, &rows[i]); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+func decodeRow[T any](row int, raw edn.RawMessage, value *T) error {
+	v := reflect.ValueOf(value).Elem()
+	if v.Kind() != reflect.Struct {
+		if err := edn.Unmarshal(raw, value); err != nil {
+			return &ColumnDecodeError{Row: row, Column: "0", Err: err}
+		}
+		return nil
+	}
+
+	var columns []edn.RawMessage
+	if err := edn.Unmarshal(raw, &columns); err == nil {
+		fields := columnFields(v.Type())
+		for i, c := range columns {
+			if i >= len(fields) {
+				break
+			}
+			f := v.FieldByIndex(fields[i].Index)
+			if err := edn.Unmarshal(c, f.Addr().Interface()); err != nil {
+				return &ColumnDecodeError{Row: row, Column: fmt.Sprintf("%d (%s)", i, fields[i].Name), Err: err}
+			}
+		}
+		return nil
+	}
+
+	var keyed map[edn.Keyword]edn.RawMessage
+	if err := edn.Unmarshal(raw, &keyed); err != nil {
+		return &ColumnDecodeError{Row: row, Column: "-", Err: fmt.Errorf("expected vector or map: %w", err)}
+	}
+	for _, sf := range columnFields(v.Type()) {
+		name := columnName(sf)
+		c, ok := keyed[edn.Keyword(name)]
+		if !ok {
+			continue
+		}
+		f := v.FieldByIndex(sf.Index)
+		if err := edn.Unmarshal(c, f.Addr().Interface()); err != nil {
+			return &ColumnDecodeError{Row: row, Column: ":" + name, Err: err}
+		}
+	}
+	return nil
+}
+
+// columnFields returns the exported fields of t that can receive a column
+func columnFields(t reflect.Type) []reflect.StructField {
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("edn") == "-" {
+			continue
+		}
+		fields = append(fields, sf)
+	}
+	return fields
+}
+
+// columnName mirrors the key the edn package uses for a struct field
+func columnName(sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get("edn"), ","); name != "" {
+		return name
+	}
+	r := []rune(sf.Name)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
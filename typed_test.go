@@ -0,0 +1,98 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"olympos.io/encoding/edn"
+)
+
+type commitRow struct {
+	Commit struct {
+		Sha string `edn:"git.commit/sha"`
+	}
+	Repo struct {
+		Name string `edn:"git.repo/name"`
+	}
+}
+
+type keyedRow struct {
+	Sha   string `edn:"sha"`
+	Count int    `edn:"count"`
+}
+
+func typedRequest(result string) RequestContext {
+	return RequestContext{
+		Event: EventIncoming{
+			Type: "subscription",
+			Context: EventContext{
+				Subscription: EventContextSubscription{Result: edn.RawMessage(result)},
+			},
+		},
+		Log: *createDefaultLogger(context.Background(), map[string]string{}),
+	}
+}
+
+func TestTypedDecodesByPosition(t *testing.T) {
+	var rows []commitRow
+	handler := Typed(func(ctx context.Context, req RequestContext, r []commitRow) Status {
+		rows = r
+		return NewCompletedStatus("done")
+	})
+
+	status := handler(context.Background(), typedRequest(`([{:git.commit/sha "abc"} {:git.repo/name "go-skill"}])`))
+	if status.State != Completed {
+		t.Fatalf("Unexpected status: %s", status.Reason)
+	}
+	if len(rows) != 1 || rows[0].Commit.Sha != "abc" || rows[0].Repo.Name != "go-skill" {
+		t.Errorf("Unexpected rows: %v", rows)
+	}
+}
+
+func TestTypedDecodesByTag(t *testing.T) {
+	var rows []keyedRow
+	handler := Typed(func(ctx context.Context, req RequestContext, r []keyedRow) Status {
+		rows = r
+		return NewCompletedStatus("done")
+	})
+
+	status := handler(context.Background(), typedRequest(`[{:sha "abc" :count 2}]`))
+	if status.State != Completed {
+		t.Fatalf("Unexpected status: %s", status.Reason)
+	}
+	if len(rows) != 1 || rows[0].Sha != "abc" || rows[0].Count != 2 {
+		t.Errorf("Unexpected rows: %v", rows)
+	}
+}
+
+func TestTypedFailsOnBadColumn(t *testing.T) {
+	handler := Typed(func(ctx context.Context, req RequestContext, r []keyedRow) Status {
+		t.Errorf("Handler should not be invoked")
+		return NewCompletedStatus("done")
+	})
+
+	status := handler(context.Background(), typedRequest(`[{:sha "abc" :count "two"}]`))
+	if status.State != Failed {
+		t.Errorf("Expected failed status")
+	}
+	if !strings.Contains(status.Reason, ":count") {
+		t.Errorf("Expected reason to name the column: %s", status.Reason)
+	}
+}
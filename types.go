@@ -18,6 +18,8 @@ package skill
 
 import (
 	"context"
+	"os"
+	"time"
 
 	"olympos.io/encoding/edn"
 )
@@ -107,16 +109,28 @@ type EventIncoming struct {
 }
 
 const (
-	queued    edn.Keyword = "queued"
-	running   edn.Keyword = "running"
+	Queued    edn.Keyword = "queued"
+	Running   edn.Keyword = "running"
 	Completed edn.Keyword = "completed"
-	retryable edn.Keyword = "retryable"
+	Retryable edn.Keyword = "retryable"
 	Failed    edn.Keyword = "failed"
 )
 
 type Status struct {
-	State       edn.Keyword `edn:"state"`
-	Reason      string      `edn:"reason,omitempty"`
+	State    edn.Keyword `edn:"state"`
+	Reason   string      `edn:"reason,omitempty"`
+	Progress *Progress   `edn:"progress,omitempty"`
+
+	// RetryAfter asks the platform to retry a retryable execution not before
+	// this delay; it is sent in milliseconds
+	RetryAfter time.Duration `edn:"-"`
+	// ErrorCode identifies the error of a failed or retryable execution
+	ErrorCode string `edn:"error-code,omitempty"`
+	// ErrorCategory classifies the error of a failed or retryable execution
+	ErrorCategory ErrorCategory `edn:"error-category,omitempty"`
+	// Details carry machine-readable information about the outcome
+	Details map[string]interface{} `edn:"details,omitempty"`
+
 	SyncRequest interface{} `edn:"sync-request,omitempty"`
 }
 
@@ -124,19 +138,51 @@ type RequestContext struct {
 	Event EventIncoming
 	Log   Logger
 
-	ctx context.Context
+	ctx               context.Context
+	transactOptions   transactOptions
+	asyncTransactions *asyncTransactions
+	progress          *progressReporter
 }
 
 func (r *RequestContext) NewTransaction() Transaction {
-	return NewTransactionFromRequest(r.ctx, r.Event, r.Log)
+	return newTransactionFromRequest(r.ctx, r.Event, r.Log, r.transactOptions)
 }
 
 func NewTransactionFromRequest(ctx context.Context, event EventIncoming, logger Logger) Transaction {
+	return newTransactionFromRequest(ctx, event, logger, transactOptions{})
+}
+
+// NewTransactionWithClient creates a Transaction like NewTransactionFromRequest
+// that sends its requests with client, e.g. to apply ClientOptions.ScoutURL, a
+// proxy or extra headers to transactions without an incoming event
+func NewTransactionWithClient(ctx context.Context, event EventIncoming, logger Logger, client *Client) Transaction {
+	return newTransactionFromRequest(ctx, event, logger, transactOptions{client: client})
+}
+
+func newTransactionFromRequest(ctx context.Context, event EventIncoming, logger Logger, options transactOptions) Transaction {
+	return newTransaction(ctx, newTransactorFromRequest(ctx, event, logger, options))
+}
+
+// NewAsyncTransaction creates an AsyncTransaction that the handler closes before
+// sending the final status of this request
+func (r *RequestContext) NewAsyncTransaction(options AsyncOptions) *AsyncTransaction {
+	t := NewAsyncTransaction(newTransactorFromRequest(r.ctx, r.Event, r.Log, r.transactOptions), options)
+	r.asyncTransactions.add(t)
+	return t
+}
+
+func newTransactorFromRequest(ctx context.Context, event EventIncoming, logger Logger, options transactOptions) Transactor {
+	// Write transactions to a file or directory instead of sending them when running offline
+	if path, ok := os.LookupEnv("ATOMIST_TRANSACT_DRY_RUN"); ok && path != "" {
+		logger.Debugf("Writing transactions to %s", path)
+		return options.validate(NewDryRunTransactor(path, event.ExecutionId))
+	}
+
 	var sender messageSender
 	if event.Type != "" {
-		sender = createMessageSender(ctx, event, logger)
+		sender = createMessageSender(ctx, event, logger, options)
 	} else {
-		sender = createHttpMessageSender(event.WorkspaceId, event.Token, event.ExecutionId, logger)
+		sender = createHttpMessageSender(ctx, event.WorkspaceId, event.Token, event.ExecutionId, logger, options)
 	}
 
 	transactor := func(entities []interface{}, ordered bool) error {
@@ -147,11 +193,15 @@ func NewTransactionFromRequest(ctx context.Context, event EventIncoming, logger
 		return sender.Transact(entities)
 	}
 
-	return newTransaction(ctx, transactor)
+	return options.validate(transactor)
 }
 
 type EventHandler func(ctx context.Context, req RequestContext) Status
 
+// Handlers resolve the EventHandler for an event name. A name that isn't
+// resolved fails the event right away, without a running status or any
+// middlewares. Handlers may still return a handler for it then, which is only
+// asked for the failed status, e.g. to explain why the name wasn't resolved
 type Handlers func(name string) (EventHandler, bool)
 
 func HandlersFromMap(handlers map[string]EventHandler) Handlers {
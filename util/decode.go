@@ -16,13 +16,42 @@
 
 package util
 
-import "olympos.io/encoding/edn"
+import (
+	"bytes"
+
+	"olympos.io/encoding/edn"
+)
 
 // Decode returns a subscription result payload as a struct of specified
-// generic type P
+// generic type P. Decoding errors are ignored; use DecodeE to handle them
 func Decode[P interface{}](event edn.RawMessage) P {
-	ednboby, _ := edn.Marshal(event)
-	var decoded P
-	edn.Unmarshal(ednboby, &decoded)
+	decoded, _ := DecodeE[P](event)
 	return decoded
 }
+
+// DecodeE returns a subscription result payload as a struct of specified
+// generic type P or the error that occurred while decoding it
+func DecodeE[P interface{}](event edn.RawMessage) (P, error) {
+	return decode[P](event, false)
+}
+
+// DecodeStrict is like DecodeE but also fails if the payload contains keywords
+// that don't map onto a field of P
+func DecodeStrict[P interface{}](event edn.RawMessage) (P, error) {
+	return decode[P](event, true)
+}
+
+func decode[P interface{}](event edn.RawMessage, strict bool) (P, error) {
+	var decoded P
+	ednbody, err := edn.Marshal(event)
+	if err != nil {
+		return decoded, err
+	}
+
+	decoder := edn.NewDecoder(bytes.NewReader(ednbody))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	err = decoder.Decode(&decoded)
+	return decoded, err
+}
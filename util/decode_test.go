@@ -0,0 +1,54 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"testing"
+
+	"olympos.io/encoding/edn"
+)
+
+type commit struct {
+	Sha string `edn:"git.commit/sha"`
+}
+
+func TestDecodeE(t *testing.T) {
+	value, err := DecodeE[commit](edn.RawMessage(`{:git.commit/sha "abc" :git.commit/message "msg"}`))
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if value.Sha != "abc" {
+		t.Errorf("Wrong value")
+	}
+
+	_, err = DecodeE[commit](edn.RawMessage(`{:git.commit/sha 1}`))
+	if err == nil {
+		t.Errorf("Expected decoding to fail")
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	_, err := DecodeStrict[commit](edn.RawMessage(`{:git.commit/sha "abc"}`))
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	_, err = DecodeStrict[commit](edn.RawMessage(`{:git.commit/sha "abc" :git.commit/message "msg"}`))
+	if err == nil {
+		t.Errorf("Expected unknown keyword to be rejected")
+	}
+}
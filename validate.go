@@ -0,0 +1,305 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"olympos.io/encoding/edn"
+)
+
+// SchemaAttribute describes an attribute or entity type of a datalog schema
+type SchemaAttribute struct {
+	ValueType   edn.Keyword   `edn:"db/valueType"`
+	Cardinality edn.Keyword   `edn:"db/cardinality"`
+	Unique      edn.Keyword   `edn:"db/unique"`
+	Doc         string        `edn:"db/doc"`
+	Attrs       []edn.Keyword `edn:"db.entity/attrs"`
+}
+
+// IsEntityType reports whether this describes an entity type instead of an attribute
+func (a SchemaAttribute) IsEntityType() bool {
+	return a.ValueType == "" && a.Attrs != nil
+}
+
+// IsMany reports whether the attribute has cardinality many
+func (a SchemaAttribute) IsMany() bool {
+	return a.Cardinality == "db.cardinality/many"
+}
+
+// Schema is a parsed datalog schema
+type Schema struct {
+	Attributes map[edn.Keyword]SchemaAttribute `edn:"attributes"`
+}
+
+// ParseSchema parses the EDN of a datalog schema
+func ParseSchema(schema string) (Schema, error) {
+	var s Schema
+	if err := edn.Unmarshal([]byte(schema), &s); err != nil {
+		return Schema{}, err
+	}
+	return s, nil
+}
+
+// ValidationError describes an attribute of a Go struct not matching the schema
+type ValidationError struct {
+	Field     string
+	Attribute edn.Keyword
+	Message   string
+}
+
+func (e ValidationError) Error() string {
+	if e.Attribute == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return fmt.Sprintf("%s (%s): %s", e.Field, e.Attribute, e.Message)
+}
+
+// ValidationErrors collects all ValidationError found in a transaction
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, v := range e {
+		messages[i] = v.Error()
+	}
+	return fmt.Sprintf("invalid transaction: %s", strings.Join(messages, "; "))
+}
+
+// Validator checks entities against the datalog schemata of a skill before they
+// are transacted. Entity types and attributes are only reported as unknown if
+// their namespace is covered by the schemata; types owned by the platform or
+// other skills, like :git/commit, are not validated
+type Validator struct {
+	attributes map[edn.Keyword]SchemaAttribute
+	namespaces map[string]bool
+}
+
+// NewValidator creates a Validator from the provided schemata
+func NewValidator(schemata ...Schemata) (*Validator, error) {
+	v := &Validator{
+		attributes: make(map[edn.Keyword]SchemaAttribute),
+		namespaces: make(map[string]bool),
+	}
+	for _, s := range schemata {
+		schema, err := ParseSchema(s.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse schema %s: %w", s.Name, err)
+		}
+		for k, a := range schema.Attributes {
+			v.attributes[k] = a
+			v.namespaces[namespace(k)] = true
+		}
+	}
+	return v, nil
+}
+
+// NewValidatorFromSpec creates a Validator from the schemata of the skill spec
+func NewValidatorFromSpec(spec SkillSpec) (*Validator, error) {
+	return NewValidator(spec.Schemata...)
+}
+
+// Validate checks unknown attributes, value types, cardinality and referenced
+// entity types of the provided entities
+func (v *Validator) Validate(entities ...interface{}) error {
+	errs := make(ValidationErrors, 0)
+	for _, e := range entities {
+		errs = v.validateValue(reflect.ValueOf(e), "", errs)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// NewValidatingTransactor validates all entities with validator before passing them
+// on to transactor
+func NewValidatingTransactor(validator *Validator, transactor Transactor) Transactor {
+	return func(entities []interface{}, ordered bool) error {
+		if err := validator.Validate(entities...); err != nil {
+			return err
+		}
+		return transactor(entities, ordered)
+	}
+}
+
+// covers reports whether the namespace of k is declared by the schemata
+func (v *Validator) covers(k edn.Keyword) bool {
+	return v.namespaces[namespace(k)]
+}
+
+func namespace(k edn.Keyword) string {
+	ns, _, _ := strings.Cut(string(k), "/")
+	return ns
+}
+
+func (v *Validator) validateValue(rv reflect.Value, path string, errs ValidationErrors) ValidationErrors {
+	if !rv.IsValid() {
+		return errs
+	}
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return errs
+		}
+		rv = rv.Elem()
+	}
+
+	switch value := rv.Interface().(type) {
+	case retractedEntity:
+		return v.validateValue(reflect.ValueOf(value.entity), path, errs)
+	case attributeRetraction:
+		if _, ok := v.attributes[value.attribute]; !ok && v.covers(value.attribute) {
+			errs = append(errs, ValidationError{Field: "RetractAttribute(" + value.ref + ")", Attribute: value.attribute, Message: "unknown attribute"})
+		}
+		return errs
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			errs = v.validateValue(rv.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Struct:
+		t := rv.Type()
+		if path == "" {
+			path = t.Name()
+		}
+		if entityType, ok := structEntityType(rv); ok {
+			if a, ok := v.attributes[entityType]; (!ok && v.covers(entityType)) || (ok && !a.IsEntityType()) {
+				errs = append(errs, ValidationError{Field: path, Message: fmt.Sprintf("unknown entity type %s", entityType)})
+			}
+		}
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() || sf.Name == "Entity" {
+				continue
+			}
+			name, _, _ := strings.Cut(sf.Tag.Get("edn"), ",")
+			if name == "" || name == "-" || strings.HasPrefix(name, "schema/") {
+				continue
+			}
+			errs = v.validateAttribute(rv.Field(i), path+"."+sf.Name, edn.Keyword(name), errs)
+		}
+	}
+	return errs
+}
+
+func (v *Validator) validateAttribute(fv reflect.Value, path string, attribute edn.Keyword, errs ValidationErrors) ValidationErrors {
+	a, ok := v.attributes[attribute]
+	if !ok && !v.covers(attribute) {
+		return errs
+	}
+	if !ok || a.IsEntityType() {
+		return append(errs, ValidationError{Field: path, Attribute: attribute, Message: "unknown attribute"})
+	}
+
+	t := fv.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	many, wrapped := false, false
+	if elem, ok := manyElemType(t); ok {
+		many, wrapped = true, true
+		t = elem
+	} else if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8 {
+		many = true
+		t = t.Elem()
+	}
+	if many != a.IsMany() {
+		errs = append(errs, ValidationError{Field: path, Attribute: attribute, Message: fmt.Sprintf("expected %s", a.Cardinality)})
+	}
+
+	if !matchesValueType(t, a.ValueType) {
+		errs = append(errs, ValidationError{Field: path, Attribute: attribute, Message: fmt.Sprintf("type %s does not match %s", t, a.ValueType)})
+	}
+
+	// validate nested entities and the entity types they reference
+	if a.ValueType == "db.type/ref" && !wrapped && t.Kind() == reflect.Struct && t != reflect.TypeOf(LookupRef{}) {
+		errs = v.validateValue(fv, path, errs)
+	}
+	return errs
+}
+
+// structEntityType returns the entity type of an embedded Entity or a field
+// tagged with schema/entity-type
+func structEntityType(rv reflect.Value) (edn.Keyword, bool) {
+	if entity, ok := entityOf(rv.Interface()); ok {
+		if entity.EntityType != "" {
+			return entity.EntityType, true
+		}
+		sf, _ := rv.Type().FieldByName("Entity")
+		return edn.Keyword(sf.Tag.Get("entity-type")), true
+	}
+	for i := 0; i < rv.NumField(); i++ {
+		sf := rv.Type().Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("edn"), ",")
+		if sf.IsExported() && name == "schema/entity-type" {
+			if entityType, ok := rv.Field(i).Interface().(edn.Keyword); ok {
+				return entityType, true
+			}
+		}
+	}
+	return "", false
+}
+
+// manyElemType returns the element type of ManyRef and ManyValues
+func manyElemType(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() != reflect.Struct || t.NumField() != 3 {
+		return nil, false
+	}
+	add, ok := t.FieldByName("Add")
+	if !ok || add.Type.Kind() != reflect.Slice {
+		return nil, false
+	}
+	if _, ok := t.FieldByName("Retract"); !ok {
+		return nil, false
+	}
+	return add.Type.Elem(), true
+}
+
+func matchesValueType(t reflect.Type, valueType edn.Keyword) bool {
+	if t.Kind() == reflect.Interface {
+		return true
+	}
+	switch valueType {
+	case "db.type/string", "db.type/uuid", "db.type/uri":
+		return t.Kind() == reflect.String && t != reflect.TypeOf(edn.Keyword(""))
+	case "db.type/keyword":
+		return t == reflect.TypeOf(edn.Keyword(""))
+	case "db.type/boolean":
+		return t.Kind() == reflect.Bool
+	case "db.type/long", "db.type/bigint":
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+		return false
+	case "db.type/float", "db.type/double", "db.type/bigdec":
+		return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+	case "db.type/instant":
+		return t == reflect.TypeOf(time.Time{})
+	case "db.type/ref":
+		// references are nested entities, entity ids or lookup refs
+		return t.Kind() == reflect.String || t.Kind() == reflect.Struct
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright © 2022 Atomist, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package skill
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const testSchema = `{:attributes
+ {:docker/image {:db.entity/attrs [:docker.image/digest :docker.image/tags :docker.image/layers]}
+  :docker.image/digest {:db/valueType :db.type/string
+                        :db/cardinality :db.cardinality/one
+                        :db/unique :db.unique/identity}
+  :docker.image/tags {:db/valueType :db.type/string
+                      :db/cardinality :db.cardinality/many}
+  :docker.image/layers {:db/valueType :db.type/ref
+                        :db/cardinality :db.cardinality/many}
+  :docker/layer {:db.entity/attrs [:docker.layer/size]}
+  :docker.layer/size {:db/valueType :db.type/long
+                      :db/cardinality :db.cardinality/one}}}`
+
+type ValidImage struct {
+	Entity `entity-type:"docker/image"`
+	Digest string             `edn:"docker.image/digest"`
+	Tags   ManyValues[string] `edn:"docker.image/tags"`
+	Layers []Layer            `edn:"docker.image/layers"`
+}
+
+type Layer struct {
+	Entity `entity-type:"docker/layer"`
+	Size   int64 `edn:"docker.layer/size"`
+}
+
+type InvalidLayer struct {
+	Entity `entity-type:"docker/blob"`
+	Size   string `edn:"docker.layer/size"`
+}
+
+type InvalidImage struct {
+	Entity `entity-type:"docker/image"`
+	Digest []string       `edn:"docker.image/digest"`
+	Tags   string         `edn:"docker.image/tags"`
+	Labels string         `edn:"docker.image/labels"`
+	Layers []InvalidLayer `edn:"docker.image/layers"`
+}
+
+func TestValidator(t *testing.T) {
+	validator, err := NewValidator(Schemata{Name: "docker", Schema: testSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := MakeEntity(ValidImage{Digest: "sha256:1", Tags: AddValues("latest"), Layers: []Layer{{Size: 1}}})
+	if err := validator.Validate(valid); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	err = validator.Validate(InvalidImage{Layers: []InvalidLayer{{}}})
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+	expected := []string{
+		"InvalidImage.Digest (:docker.image/digest): expected :db.cardinality/one",
+		"InvalidImage.Tags (:docker.image/tags): expected :db.cardinality/many",
+		"InvalidImage.Labels (:docker.image/labels): unknown attribute",
+		"InvalidImage.Layers[0]: unknown entity type :docker/blob",
+		"InvalidImage.Layers[0].Size (:docker.layer/size): type string does not match :db.type/long",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %s", len(expected), len(errs), err)
+	}
+	for i, e := range expected {
+		if errs[i].Error() != e {
+			t.Errorf("Expected %q, got %q", e, errs[i].Error())
+		}
+	}
+}
+
+type Commit struct {
+	Entity `entity-type:"git/commit"`
+	Sha    string `edn:"git.commit/sha"`
+}
+
+func TestValidatorIgnoresForeignNamespaces(t *testing.T) {
+	validator, err := NewValidator(Schemata{Name: "docker", Schema: testSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var image *ValidImage
+	err = validator.Validate(nil, image, []interface{}{nil}, Commit{Sha: "1234"})
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	recorder := NewRecordingTransactor("")
+	transaction := NewTransaction(context.Background(), NewValidatingTransactor(validator, recorder.Transactor())).
+		AddEntities(nil, Commit{Sha: "1234"}).
+		RetractAttribute("$commit", "git.commit/message", "stale")
+	if err := transaction.Transact(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestValidatingTransactor(t *testing.T) {
+	validator, err := NewValidator(Schemata{Name: "docker", Schema: testSchema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := NewRecordingTransactor("")
+
+	err = NewTransaction(context.Background(), NewValidatingTransactor(validator, recorder.Transactor())).
+		AddEntities(InvalidImage{}).
+		Transact()
+	if err == nil {
+		t.Error("Expected validation error")
+	}
+	if len(recorder.Transactions()) != 0 {
+		t.Error("Expected invalid transaction not to be sent")
+	}
+}